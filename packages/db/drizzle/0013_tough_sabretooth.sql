@@ -0,0 +1 @@
+ALTER TABLE "test_cases" ADD COLUMN "expected_error" text;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE "prompt_templates" (
+	"id" uuid PRIMARY KEY DEFAULT gen_random_uuid() NOT NULL,
+	"name" text NOT NULL,
+	"version" integer NOT NULL,
+	"body" text NOT NULL,
+	"is_active" boolean DEFAULT true NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	CONSTRAINT "prompt_templates_name_version_unique" UNIQUE("name","version")
+);
\ No newline at end of file
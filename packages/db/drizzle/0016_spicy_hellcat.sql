@@ -0,0 +1,8 @@
+CREATE TABLE "ai_completion_cache" (
+	"key" text PRIMARY KEY NOT NULL,
+	"response" jsonb NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"expires_at" timestamp
+);
+--> statement-breakpoint
+CREATE INDEX "ai_completion_cache_expires_at_idx" ON "ai_completion_cache" USING btree ("expires_at");
\ No newline at end of file
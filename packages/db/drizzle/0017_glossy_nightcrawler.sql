@@ -0,0 +1,10 @@
+ALTER TABLE "models" ADD COLUMN "provider" text;--> statement-breakpoint
+ALTER TABLE "models" ADD COLUMN "provider_model" text;--> statement-breakpoint
+ALTER TABLE "models" ADD COLUMN "context_window" integer;--> statement-breakpoint
+ALTER TABLE "models" ADD COLUMN "prompt_price_per_token" double precision;--> statement-breakpoint
+ALTER TABLE "models" ADD COLUMN "completion_price_per_token" double precision;--> statement-breakpoint
+ALTER TABLE "models" ADD COLUMN "default_params" jsonb;--> statement-breakpoint
+ALTER TABLE "models" ADD COLUMN "allowed_steps" jsonb DEFAULT '[]'::jsonb NOT NULL;--> statement-breakpoint
+ALTER TABLE "models" ADD COLUMN "is_active" boolean DEFAULT true NOT NULL;--> statement-breakpoint
+ALTER TABLE "models" ADD COLUMN "created_at" timestamp DEFAULT now() NOT NULL;--> statement-breakpoint
+ALTER TABLE "models" ADD COLUMN "updated_at" timestamp DEFAULT now() NOT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE "problems" ADD COLUMN "solution_language" text DEFAULT 'python' NOT NULL;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- Keep only the newest active job of each problem before enforcing one per problem
+UPDATE "generation_jobs" SET "status" = 'failed', "error" = 'superseded by a newer generation job', "updated_at" = now()
+WHERE "status" IN ('pending', 'in_progress') AND "id" NOT IN (
+	SELECT DISTINCT ON ("problem_id") "id" FROM "generation_jobs"
+	WHERE "status" IN ('pending', 'in_progress')
+	ORDER BY "problem_id", "created_at" DESC
+);--> statement-breakpoint
+CREATE UNIQUE INDEX "generation_jobs_active_problem_idx" ON "generation_jobs" USING btree ("problem_id") WHERE "generation_jobs"."status" in ('pending', 'in_progress');
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE "generation_jobs" ADD COLUMN "bypass_cache" boolean DEFAULT false NOT NULL;
\ No newline at end of file
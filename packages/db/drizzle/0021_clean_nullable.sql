@@ -0,0 +1,4 @@
+-- Test cases used to store a JSON null for outputs that were not produced yet. Only SQL NULL
+-- means that now, so clear them; a legitimately null output is recomputed when the outputs
+-- step runs again.
+UPDATE "test_cases" SET "expected" = NULL WHERE "expected" = 'null'::jsonb AND "expected_error" IS NULL;
\ No newline at end of file
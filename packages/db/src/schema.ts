@@ -1,4 +1,4 @@
-import { relations } from "drizzle-orm";
+import { relations, sql } from "drizzle-orm";
 import {
   pgTable,
   pgEnum,
@@ -8,13 +8,35 @@ import {
   jsonb,
   timestamp,
   integer,
+  doublePrecision,
   unique,
+  index,
+  uniqueIndex,
 } from "drizzle-orm/pg-core";
 import type { FunctionSignatureSchema } from "@repo/api-types";
 
 export const models = pgTable("models", {
   id: uuid("id").primaryKey().defaultRandom(),
   name: text("name").notNull().unique(),
+  // Provider that serves the model, and the model string it expects. Null uses the
+  // configured provider chain and the model name.
+  provider: text("provider"),
+  providerModel: text("provider_model"),
+  contextWindow: integer("context_window"),
+  // USD per token
+  promptPricePerToken: doublePrecision("prompt_price_per_token"),
+  completionPricePerToken: doublePrecision("completion_price_per_token"),
+  defaultParams: jsonb("default_params").$type<{
+    temperature?: number;
+    maxTokens?: number;
+    stop?: string[];
+    seed?: number;
+  }>(),
+  // Pipeline steps the model may be used for; empty allows every step
+  allowedSteps: jsonb("allowed_steps").$type<string[]>().default([]).notNull(),
+  isActive: boolean("is_active").default(true).notNull(),
+  createdAt: timestamp("created_at").defaultNow().notNull(),
+  updatedAt: timestamp("updated_at").defaultNow().notNull(),
 });
 
 export const problems = pgTable("problems", {
@@ -26,6 +48,8 @@ export const problems = pgTable("problems", {
   ).$type<FunctionSignatureSchema>(),
   problemTextReworded: text("problem_text_reworded").notNull(),
   solution: text("solution"),
+  // Runner language of the solution: python, javascript, typescript or go
+  solutionLanguage: text("solution_language").notNull().default("python"),
   generatedByModelId: uuid("generated_by_model_id").references(() => models.id),
   generatedByUserId: text("generated_by_user_id").notNull(),
   easierThan: uuid("easier_than"),
@@ -73,10 +97,26 @@ export const testCases = pgTable("test_cases", {
   inputCode: text("input_code"),
   input: jsonb("input"),
   expected: jsonb("expected"),
+  // Set when the reference solution crashed or timed out on this input
+  expectedError: text("expected_error"),
   createdAt: timestamp("created_at").defaultNow().notNull(),
   updatedAt: timestamp("updated_at").defaultNow().notNull(),
 });
 
+// Prompt templates (versioned overrides of the Go backend's embedded prompts)
+export const promptTemplates = pgTable(
+  "prompt_templates",
+  {
+    id: uuid("id").primaryKey().defaultRandom(),
+    name: text("name").notNull(),
+    version: integer("version").notNull(),
+    body: text("body").notNull(),
+    isActive: boolean("is_active").default(true).notNull(),
+    createdAt: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => [unique().on(table.name, table.version)],
+);
+
 // Relations
 export const modelsRelations = relations(models, ({ many }) => ({
   problems: many(problems),
@@ -155,19 +195,30 @@ export const userProblemAttempts = pgTable("user_problem_attempts", {
   updatedAt: timestamp("updated_at").defaultNow().notNull(),
 });
 
-export const generationJobs = pgTable("generation_jobs", {
-  id: uuid("id").primaryKey().defaultRandom(),
-  problemId: uuid("problem_id")
-    .notNull()
-    .references(() => problems.id, { onDelete: "cascade" }),
-  modelId: uuid("model_id").references(() => models.id),
-  status: generationJobStatus("status").notNull().default("pending"),
-  currentStep: text("current_step"),
-  completedSteps: jsonb("completed_steps").$type<string[]>().default([]),
-  error: text("error"),
-  createdAt: timestamp("created_at").defaultNow().notNull(),
-  updatedAt: timestamp("updated_at").defaultNow().notNull(),
-});
+export const generationJobs = pgTable(
+  "generation_jobs",
+  {
+    id: uuid("id").primaryKey().defaultRandom(),
+    problemId: uuid("problem_id")
+      .notNull()
+      .references(() => problems.id, { onDelete: "cascade" }),
+    modelId: uuid("model_id").references(() => models.id),
+    status: generationJobStatus("status").notNull().default("pending"),
+    currentStep: text("current_step"),
+    completedSteps: jsonb("completed_steps").$type<string[]>().default([]),
+    error: text("error"),
+    // Skip the AI completion cache lookup, so every step calls the provider
+    bypassCache: boolean("bypass_cache").default(false).notNull(),
+    createdAt: timestamp("created_at").defaultNow().notNull(),
+    updatedAt: timestamp("updated_at").defaultNow().notNull(),
+  },
+  // A problem has at most one pending or running job
+  (table) => [
+    uniqueIndex("generation_jobs_active_problem_idx")
+      .on(table.problemId)
+      .where(sql`${table.status} in ('pending', 'in_progress')`),
+  ],
+);
 
 export const generationJobsRelations = relations(generationJobs, ({ one }) => ({
   problem: one(problems, {
@@ -180,6 +231,62 @@ export const generationJobsRelations = relations(generationJobs, ({ one }) => ({
   }),
 }));
 
+// AI Usage: one row per AI call, with its token counts and estimated cost
+export const aiUsage = pgTable(
+  "ai_usage",
+  {
+    id: uuid("id").primaryKey().defaultRandom(),
+    jobId: uuid("job_id").references(() => generationJobs.id, {
+      onDelete: "set null",
+    }),
+    problemId: uuid("problem_id").references(() => problems.id, {
+      onDelete: "set null",
+    }),
+    step: text("step"),
+    modelId: uuid("model_id").references(() => models.id, {
+      onDelete: "set null",
+    }),
+    // Provider and model string that actually served the call
+    provider: text("provider").notNull(),
+    model: text("model").notNull(),
+    promptTokens: integer("prompt_tokens").default(0).notNull(),
+    completionTokens: integer("completion_tokens").default(0).notNull(),
+    latencyMs: integer("latency_ms").notNull(),
+    // Null when no price is known for the model
+    costUsd: doublePrecision("cost_usd"),
+    createdAt: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => [index("ai_usage_created_at_idx").on(table.createdAt)],
+);
+
+// Cached AI completions, keyed by a hash of the provider and request
+export const aiCompletionCache = pgTable(
+  "ai_completion_cache",
+  {
+    key: text("key").primaryKey(),
+    response: jsonb("response").notNull(),
+    createdAt: timestamp("created_at").defaultNow().notNull(),
+    // Null when entries never expire
+    expiresAt: timestamp("expires_at"),
+  },
+  (table) => [index("ai_completion_cache_expires_at_idx").on(table.expiresAt)],
+);
+
+export const aiUsageRelations = relations(aiUsage, ({ one }) => ({
+  job: one(generationJobs, {
+    fields: [aiUsage.jobId],
+    references: [generationJobs.id],
+  }),
+  problem: one(problems, {
+    fields: [aiUsage.problemId],
+    references: [problems.id],
+  }),
+  model: one(models, {
+    fields: [aiUsage.modelId],
+    references: [models.id],
+  }),
+}));
+
 export const userProblemAttemptsRelations = relations(
   userProblemAttempts,
   ({ one }) => ({
@@ -203,5 +310,11 @@ export type FocusArea = typeof focusAreas.$inferSelect;
 export type NewFocusArea = typeof focusAreas.$inferInsert;
 export type ProblemFocusArea = typeof problemFocusAreas.$inferSelect;
 export type NewProblemFocusArea = typeof problemFocusAreas.$inferInsert;
+export type PromptTemplate = typeof promptTemplates.$inferSelect;
+export type NewPromptTemplate = typeof promptTemplates.$inferInsert;
+export type AIUsage = typeof aiUsage.$inferSelect;
+export type NewAIUsage = typeof aiUsage.$inferInsert;
+export type AICompletionCacheEntry = typeof aiCompletionCache.$inferSelect;
+export type NewAICompletionCacheEntry = typeof aiCompletionCache.$inferInsert;
 export type UserProblemAttempt = typeof userProblemAttempts.$inferSelect;
 export type NewUserProblemAttempt = typeof userProblemAttempts.$inferInsert;
@@ -12,9 +12,12 @@ import (
 
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/config"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/database"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/executor"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/handler"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/middleware"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/prompts"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/runner"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/service"
 )
 
@@ -40,23 +43,105 @@ func main() {
 	modelRepo := repository.NewModelRepository(db)
 	focusRepo := repository.NewFocusAreaRepository(db)
 	jobRepo := repository.NewGenerationJobRepository(db)
+	templateRepo := repository.NewPromptTemplateRepository(db)
+	usageRepo := repository.NewAIUsageRepository(db)
+	cacheRepo := repository.NewAICacheRepository(db)
 
 	// Initialize AI service
-	aiService, err := service.NewAIService(cfg.AIProvider, cfg.OpenRouterAPIKey, cfg.GeminiAPIKey)
+	prices, err := service.LoadPriceTable(cfg.AIPriceTable)
+	if err != nil {
+		log.Fatalf("Failed to load AI price table: %v", err)
+	}
+	limits, err := service.LoadRateLimits(cfg.AIRateLimits)
+	if err != nil {
+		log.Fatalf("Failed to load AI rate limits: %v", err)
+	}
+	aiCache, err := service.NewCompletionCache(cfg.AICache, cacheRepo, cfg.AICacheDir, cfg.AICacheTTL)
+	if err != nil {
+		log.Fatalf("Failed to initialize AI cache: %v", err)
+	}
+	if aiCache != nil {
+		removed, err := aiCache.DeleteExpired(ctx)
+		if err != nil {
+			log.Printf("Failed to prune AI cache: %v", err)
+		}
+		log.Printf("AI cache enabled (%s), removed %d expired entries", cfg.AICache, removed)
+	}
+	aiService, err := service.NewAIService(service.AIConfig{
+		Provider:          cfg.AIProvider,
+		FallbackProviders: cfg.AIFallbackProviders,
+		OpenRouterAPIKey:  cfg.OpenRouterAPIKey,
+		OpenRouterBaseURL: cfg.OpenRouterBaseURL,
+		GeminiAPIKey:      cfg.GeminiAPIKey,
+		OpenAICompatible: service.OpenAICompatibleConfig{
+			BaseURL:      cfg.OpenAICompatibleBaseURL,
+			APIKey:       cfg.OpenAICompatibleAPIKey,
+			Headers:      cfg.OpenAICompatibleHeaders,
+			DefaultModel: cfg.OpenAICompatibleModel,
+		},
+		Replay: service.ReplayConfig{
+			Dir:      cfg.AIReplayDir,
+			Mode:     cfg.AIReplayMode,
+			Strict:   cfg.AIReplayStrict,
+			Upstream: cfg.AIReplayUpstream,
+		},
+		Timeout: cfg.AIRequestTimeout,
+		Retry: service.RetryPolicy{
+			MaxAttempts: cfg.AIMaxAttempts,
+			BaseDelay:   cfg.AIRetryBaseDelay,
+			MaxDelay:    cfg.AIRetryMaxDelay,
+		},
+		Prices: prices,
+		Cache:  aiCache,
+		Limits: limits,
+	}, usageRepo, modelRepo)
 	if err != nil {
 		log.Fatalf("Failed to initialize AI service: %v", err)
 	}
 	log.Printf("AI service initialized with provider: %s", cfg.AIProvider)
 
+	// Initialize code executor
+	codeExecutor := executor.New(executor.Limits{
+		Timeout:       cfg.ExecutorTimeout,
+		CPUTime:       cfg.ExecutorCPUTime,
+		MemoryBytes:   int64(cfg.ExecutorMemoryMB) << 20,
+		OutputBytes:   cfg.ExecutorOutputBytes,
+		FileSizeBytes: int64(cfg.ExecutorFileSizeMB) << 20,
+		MaxProcesses:  cfg.ExecutorMaxProcesses,
+		MaxConcurrent: cfg.ExecutorMaxConcurrent,
+	})
+	if !codeExecutor.NetworkIsolated() {
+		log.Println("Network namespaces are unavailable; generated code runs with network access")
+	}
+
+	runners := runner.NewRegistry(runner.Config{GoCacheDir: cfg.ExecutorGoCache})
+	if _, err := runners.Runnable(cfg.SolutionLanguage); err != nil {
+		log.Fatalf("SOLUTION_LANGUAGE is %s, which this server cannot run: %v", cfg.SolutionLanguage, err)
+	}
+	for _, language := range runners.Languages() {
+		if _, err := runners.Runnable(language); err != nil {
+			log.Printf("Submissions in %s are disabled: %v", language, err)
+		}
+	}
+
+	// Initialize prompt templates
+	promptRenderer := prompts.NewRenderer(templateRepo, cfg.PromptTemplateDir)
+
 	// Initialize services
-	problemService := service.NewProblemService(problemRepo, jobRepo, aiService)
+	problemService := service.NewProblemService(problemRepo, focusRepo, modelRepo, jobRepo, aiService, codeExecutor, runners, promptRenderer, cfg.SolutionLanguage)
+
+	// Start generation worker
+	workerCtx, stopWorker := context.WithCancel(ctx)
+	worker := service.NewWorker(jobRepo, problemService, cfg.WorkerConcurrency, cfg.WorkerPollInterval, cfg.WorkerJobLease)
+	worker.Start(workerCtx)
+	log.Printf("Generation worker started with %d goroutines", cfg.WorkerConcurrency)
 
 	// Initialize handlers
-	problemHandler := handler.NewProblemHandler(problemRepo, focusRepo, jobRepo)
+	problemHandler := handler.NewProblemHandler(problemRepo, focusRepo, problemService)
 	modelHandler := handler.NewModelHandler(modelRepo)
 	focusHandler := handler.NewFocusAreaHandler(focusRepo)
-	
-	_ = problemService // Will be used in future handlers
+	templateHandler := handler.NewPromptTemplateHandler(templateRepo, promptRenderer)
+	usageHandler := handler.NewUsageHandler(usageRepo, aiService)
 
 	// Setup router
 	mux := http.NewServeMux()
@@ -70,11 +155,28 @@ func main() {
 
 	// API routes
 	mux.HandleFunc("GET /api/v1/models", modelHandler.ListModels)
+	mux.HandleFunc("GET /api/v1/admin/models", modelHandler.ListAllModels)
+	mux.HandleFunc("POST /api/v1/admin/models", modelHandler.CreateModel)
+	mux.HandleFunc("PATCH /api/v1/admin/models/{id}", modelHandler.UpdateModel)
+	mux.HandleFunc("DELETE /api/v1/admin/models/{id}", modelHandler.DeactivateModel)
 	mux.HandleFunc("GET /api/v1/focus-areas", focusHandler.ListFocusAreas)
 	mux.HandleFunc("POST /api/v1/problems", problemHandler.CreateProblem)
 	mux.HandleFunc("GET /api/v1/problems", problemHandler.ListProblems)
 	mux.HandleFunc("GET /api/v1/problems/{id}", problemHandler.GetProblem)
 	mux.HandleFunc("GET /api/v1/problems/{id}/focus-areas", problemHandler.GetProblemFocusAreas)
+	mux.HandleFunc("POST /api/v1/problems/{id}/generate", problemHandler.GenerateProblem)
+	mux.HandleFunc("POST /api/v1/problems/{id}/reword", problemHandler.RewordProblem)
+	mux.HandleFunc("POST /api/v1/problems/{id}/problem-text/stream", problemHandler.StreamProblemText)
+	mux.HandleFunc("POST /api/v1/problems/{id}/variants", problemHandler.CreateVariant)
+	mux.HandleFunc("POST /api/v1/problems/{id}/submissions/run", problemHandler.RunSubmission)
+	mux.HandleFunc("POST /api/v1/problems/{id}/submissions/run-custom", problemHandler.RunCustomInputs)
+	mux.HandleFunc("GET /api/v1/problems/{id}/starter-code", problemHandler.GetStarterCode)
+	mux.HandleFunc("GET /api/v1/prompt-templates", templateHandler.ListPromptTemplates)
+	mux.HandleFunc("GET /api/v1/prompt-templates/{name}", templateHandler.GetPromptTemplate)
+	mux.HandleFunc("POST /api/v1/prompt-templates/{name}", templateHandler.CreatePromptTemplateVersion)
+	mux.HandleFunc("PATCH /api/v1/prompt-templates/{name}/versions/{version}", templateHandler.UpdatePromptTemplateVersion)
+	mux.HandleFunc("GET /api/v1/usage", usageHandler.GetUsage)
+	mux.HandleFunc("GET /api/v1/usage/cache", usageHandler.GetCacheStats)
 
 	// Apply middleware
 	handler := middleware.Logging(mux)
@@ -112,5 +214,11 @@ func main() {
 		log.Printf("Server shutdown error: %v", err)
 	}
 
+	// On a graceful shutdown, interrupted jobs are returned to pending so they resume on
+	// next start. Jobs of a process that dies without one are reclaimed once their lease
+	// expires (WORKER_JOB_LEASE).
+	stopWorker()
+	worker.Wait()
+
 	log.Println("Server stopped")
 }
@@ -1,31 +1,181 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds application configuration
 type Config struct {
 	DatabaseURL      string
-	AIProvider       string // "openrouter" or "gemini"
+	AIProvider       string // "openrouter", "gemini", "openai-compatible" or "replay"
 	OpenRouterAPIKey string
 	GeminiAPIKey     string
-	Port             string
-	CORSOrigins      string
-	LogLevel         string
+	// OpenRouterBaseURL optionally overrides OpenRouter's API URL
+	OpenRouterBaseURL string
+	Port              string
+	CORSOrigins       string
+	LogLevel          string
+
+	// Server implementing the OpenAI chat completions API, such as vLLM or llama.cpp
+	OpenAICompatibleBaseURL string
+	OpenAICompatibleAPIKey  string
+	OpenAICompatibleHeaders map[string]string
+	OpenAICompatibleModel   string
+
+	// Replay provider: cassette directory, mode ("replay" or "record"), whether unrecorded
+	// requests fail, and the provider that records exchanges
+	AIReplayDir      string
+	AIReplayMode     string
+	AIReplayStrict   bool
+	AIReplayUpstream string
+
+	// AIRequestTimeout bounds a blocking AI request, and how long a streaming request
+	// may wait for the provider to start responding
+	AIRequestTimeout time.Duration
+
+	// AIFallbackProviders are tried in order when AIProvider keeps failing
+	AIFallbackProviders []string
+
+	// Retry policy for rate limit and server errors from AI providers
+	AIMaxAttempts    int
+	AIRetryBaseDelay time.Duration
+	AIRetryMaxDelay  time.Duration
+
+	// AICache selects the completion cache backend ("postgres" or "filesystem"), or
+	// disables caching when empty. AICacheDir is used by the filesystem backend.
+	AICache    string
+	AICacheDir string
+	AICacheTTL time.Duration
+
+	// AIRateLimits is an optional JSON file of per-provider and per-model rate limits
+	AIRateLimits string
+
+	// AIPriceTable is an optional JSON file of per-model token prices for cost estimates
+	AIPriceTable string
+
+	// Generation worker settings
+	WorkerConcurrency  int
+	WorkerPollInterval time.Duration
+	// WorkerJobLease is how long an in-progress job may go without a heartbeat before it
+	// is considered abandoned and claimed again
+	WorkerJobLease time.Duration
+
+	// ExecutorTimeout is the default wall-clock limit for sandboxed programs
+	ExecutorTimeout time.Duration
+	// Resource limits for sandboxed programs. Zero disables a limit.
+	ExecutorCPUTime      time.Duration
+	ExecutorMemoryMB     int
+	ExecutorOutputBytes  int
+	ExecutorFileSizeMB   int
+	ExecutorMaxProcesses int
+	// ExecutorMaxConcurrent bounds the sandboxed programs running at once across the server
+	ExecutorMaxConcurrent int
+	// ExecutorGoCache is the build cache shared by builds of Go solutions
+	ExecutorGoCache string
+
+	// SolutionLanguage is the language reference solutions are generated in
+	SolutionLanguage string
+
+	// PromptTemplateDir optionally overrides the embedded prompt templates
+	PromptTemplateDir string
 }
 
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	cfg := &Config{
-		DatabaseURL:      os.Getenv("DATABASE_URL"),
-		AIProvider:       getEnvOrDefault("AI_PROVIDER", "openrouter"),
-		OpenRouterAPIKey: os.Getenv("OPENROUTER_API_KEY"),
-		GeminiAPIKey:     os.Getenv("GEMINI_API_KEY"),
+		DatabaseURL:       os.Getenv("DATABASE_URL"),
+		AIProvider:        getEnvOrDefault("AI_PROVIDER", "openrouter"),
+		OpenRouterAPIKey:  os.Getenv("OPENROUTER_API_KEY"),
+		GeminiAPIKey:      os.Getenv("GEMINI_API_KEY"),
+		OpenRouterBaseURL: os.Getenv("OPENROUTER_BASE_URL"),
+
+		OpenAICompatibleBaseURL: os.Getenv("OPENAI_COMPATIBLE_BASE_URL"),
+		OpenAICompatibleAPIKey:  os.Getenv("OPENAI_COMPATIBLE_API_KEY"),
+		OpenAICompatibleModel:   os.Getenv("OPENAI_COMPATIBLE_MODEL"),
+
+		AIReplayDir:      getEnvOrDefault("AI_REPLAY_DIR", "testdata/cassettes"),
+		AIReplayMode:     getEnvOrDefault("AI_REPLAY_MODE", "replay"),
+		AIReplayUpstream: os.Getenv("AI_REPLAY_UPSTREAM"),
 		Port:             getEnvOrDefault("PORT", "8080"),
 		CORSOrigins:      getEnvOrDefault("CORS_ORIGINS", "http://localhost:3000"),
 		LogLevel:         getEnvOrDefault("LOG_LEVEL", "info"),
+
+		PromptTemplateDir: os.Getenv("PROMPT_TEMPLATE_DIR"),
+		AIPriceTable:      os.Getenv("AI_PRICE_TABLE"),
+		AIRateLimits:      os.Getenv("AI_RATE_LIMITS"),
+		AICache:           os.Getenv("AI_CACHE"),
+		AICacheDir:        getEnvOrDefault("AI_CACHE_DIR", ".ai-cache"),
+		ExecutorGoCache:   getEnvOrDefault("EXECUTOR_GO_CACHE", ".go-cache"),
+		SolutionLanguage:  getEnvOrDefault("SOLUTION_LANGUAGE", "python"),
+	}
+
+	var err error
+	if cfg.WorkerConcurrency, err = getEnvIntOrDefault("WORKER_CONCURRENCY", 2); err != nil {
+		return nil, err
+	}
+	if cfg.WorkerPollInterval, err = getEnvDurationOrDefault("WORKER_POLL_INTERVAL", 2*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.WorkerJobLease, err = getEnvDurationOrDefault("WORKER_JOB_LEASE", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.WorkerJobLease <= 0 {
+		return nil, fmt.Errorf("WORKER_JOB_LEASE must be positive, got %s", cfg.WorkerJobLease)
+	}
+	if cfg.AIRequestTimeout, err = getEnvDurationOrDefault("AI_REQUEST_TIMEOUT", 2*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.AIMaxAttempts, err = getEnvIntOrDefault("AI_MAX_ATTEMPTS", 3); err != nil {
+		return nil, err
+	}
+	if cfg.AIRetryBaseDelay, err = getEnvDurationOrDefault("AI_RETRY_BASE_DELAY", time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.AIRetryMaxDelay, err = getEnvDurationOrDefault("AI_RETRY_MAX_DELAY", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.AIReplayStrict, err = getEnvBoolOrDefault("AI_REPLAY_STRICT", false); err != nil {
+		return nil, err
+	}
+	if cfg.AICacheTTL, err = getEnvDurationOrDefault("AI_CACHE_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(os.Getenv("AI_FALLBACK_PROVIDERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.AIFallbackProviders = append(cfg.AIFallbackProviders, name)
+		}
+	}
+	if cfg.ExecutorTimeout, err = getEnvDurationOrDefault("EXECUTOR_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ExecutorCPUTime, err = getEnvDurationOrDefault("EXECUTOR_CPU_TIME", cfg.ExecutorTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.ExecutorMemoryMB, err = getEnvIntOrDefault("EXECUTOR_MEMORY_MB", 512); err != nil {
+		return nil, err
+	}
+	if cfg.ExecutorOutputBytes, err = getEnvIntOrDefault("EXECUTOR_OUTPUT_BYTES", 1<<20); err != nil {
+		return nil, err
+	}
+	if cfg.ExecutorFileSizeMB, err = getEnvIntOrDefault("EXECUTOR_FILE_SIZE_MB", 64); err != nil {
+		return nil, err
+	}
+	if cfg.ExecutorMaxProcesses, err = getEnvIntOrDefault("EXECUTOR_MAX_PROCESSES", 512); err != nil {
+		return nil, err
+	}
+	if cfg.ExecutorMaxConcurrent, err = getEnvIntOrDefault("EXECUTOR_MAX_CONCURRENT", runtime.NumCPU()); err != nil {
+		return nil, err
+	}
+	if headers := os.Getenv("OPENAI_COMPATIBLE_HEADERS"); headers != "" {
+		if err := json.Unmarshal([]byte(headers), &cfg.OpenAICompatibleHeaders); err != nil {
+			return nil, fmt.Errorf("OPENAI_COMPATIBLE_HEADERS must be a JSON object of strings: %w", err)
+		}
 	}
 
 	if cfg.DatabaseURL == "" {
@@ -33,24 +183,105 @@ func Load() (*Config, error) {
 	}
 
 	// Validate AI provider configuration
-	if cfg.AIProvider != "openrouter" && cfg.AIProvider != "gemini" {
-		return nil, fmt.Errorf("AI_PROVIDER must be either 'openrouter' or 'gemini'")
+	if err := cfg.validateProvider("AI_PROVIDER", cfg.AIProvider); err != nil {
+		return nil, err
+	}
+	for _, name := range cfg.AIFallbackProviders {
+		if err := cfg.validateProvider("AI_FALLBACK_PROVIDERS", name); err != nil {
+			return nil, err
+		}
 	}
 
-	if cfg.AIProvider == "openrouter" && cfg.OpenRouterAPIKey == "" {
-		return nil, fmt.Errorf("OPENROUTER_API_KEY is required when AI_PROVIDER is 'openrouter'")
+	if cfg.AICache != "" && cfg.AICache != "postgres" && cfg.AICache != "filesystem" {
+		return nil, fmt.Errorf("AI_CACHE must be 'postgres' or 'filesystem', got '%s'", cfg.AICache)
 	}
 
-	if cfg.AIProvider == "gemini" && cfg.GeminiAPIKey == "" {
-		return nil, fmt.Errorf("GEMINI_API_KEY is required when AI_PROVIDER is 'gemini'")
+	switch cfg.SolutionLanguage {
+	case "python", "javascript", "typescript", "go":
+	default:
+		return nil, fmt.Errorf("SOLUTION_LANGUAGE must be 'python', 'javascript', 'typescript' or 'go', got '%s'", cfg.SolutionLanguage)
 	}
 
 	return cfg, nil
 }
 
+// validateProvider checks that a provider named by the given variable is known and configured
+func (cfg *Config) validateProvider(key, name string) error {
+	if name != "openrouter" && name != "gemini" && name != "openai-compatible" && name != "replay" {
+		return fmt.Errorf("%s must only name 'openrouter', 'gemini', 'openai-compatible' or 'replay', got '%s'", key, name)
+	}
+
+	if name == "openrouter" && cfg.OpenRouterAPIKey == "" {
+		return fmt.Errorf("OPENROUTER_API_KEY is required when %s includes 'openrouter'", key)
+	}
+
+	if name == "gemini" && cfg.GeminiAPIKey == "" {
+		return fmt.Errorf("GEMINI_API_KEY is required when %s includes 'gemini'", key)
+	}
+
+	// The API key is optional, since local servers often don't check one
+	if name == "openai-compatible" && cfg.OpenAICompatibleBaseURL == "" {
+		return fmt.Errorf("OPENAI_COMPATIBLE_BASE_URL is required when %s includes 'openai-compatible'", key)
+	}
+
+	if name == "replay" {
+		if cfg.AIReplayMode != "replay" && cfg.AIReplayMode != "record" {
+			return fmt.Errorf("AI_REPLAY_MODE must be 'replay' or 'record', got '%s'", cfg.AIReplayMode)
+		}
+		if cfg.AIReplayUpstream == "" {
+			if cfg.AIReplayMode == "record" {
+				return fmt.Errorf("AI_REPLAY_UPSTREAM is required when AI_REPLAY_MODE is 'record'")
+			}
+			return nil
+		}
+		if cfg.AIReplayUpstream == "replay" {
+			return fmt.Errorf("AI_REPLAY_UPSTREAM cannot be 'replay'")
+		}
+		return cfg.validateProvider("AI_REPLAY_UPSTREAM", cfg.AIReplayUpstream)
+	}
+
+	return nil
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvIntOrDefault(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %w", key, err)
+	}
+	return n, nil
+}
+
+func getEnvBoolOrDefault(key string, defaultValue bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false: %w", key, err)
+	}
+	return b, nil
+}
+
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration (e.g. 2s): %w", key, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,275 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Request describes a program to run
+type Request struct {
+	// Command is the program and its arguments, resolved inside the scratch directory
+	Command []string
+	// Files are written to the scratch directory before the command starts
+	Files map[string]string
+	// Stdin is fed to the program's standard input
+	Stdin []byte
+	// Env holds extra NAME=value environment variables, such as settings for a compiler
+	Env []string
+	// Collect names files to read back from the scratch directory once the program exits
+	Collect []string
+	// Timeout overrides the executor's default wall-clock limit when positive
+	Timeout time.Duration
+}
+
+// Result is the outcome of running a program
+type Result struct {
+	ExitCode int           `json:"exitCode"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	TimedOut bool          `json:"timedOut"`
+	Duration time.Duration `json:"duration"`
+	// Signal names the signal that killed the program, if any
+	Signal           string `json:"signal,omitempty"`
+	CPULimitExceeded bool   `json:"cpuLimitExceeded"`
+	// OutputLimitExceeded means stdout or stderr passed the output limit, was cut off
+	// there and the program was killed
+	OutputLimitExceeded bool          `json:"outputLimitExceeded"`
+	Usage               ResourceUsage `json:"usage"`
+	// Files holds the collected files that exist, by name
+	Files map[string]string `json:"-"`
+}
+
+// ResourceUsage is what the program consumed, as reported by the kernel
+type ResourceUsage struct {
+	UserTime    time.Duration `json:"userTime"`
+	SystemTime  time.Duration `json:"systemTime"`
+	MaxRSSBytes int64         `json:"maxRssBytes"`
+}
+
+// Failure describes why the program did not complete successfully, or returns "" if it did
+func (r *Result) Failure() string {
+	switch {
+	case r.TimedOut:
+		return "timed out"
+	case r.CPULimitExceeded:
+		return "exceeded the CPU time limit"
+	case r.OutputLimitExceeded:
+		return "exceeded the output limit"
+	case r.Signal != "":
+		return "killed by " + r.Signal
+	case r.ExitCode != 0:
+		return fmt.Sprintf("exited with code %d", r.ExitCode)
+	}
+	return ""
+}
+
+// Limits bound the resources of each program, and how many run at once. Zero fields are
+// unlimited.
+type Limits struct {
+	// Timeout is the default wall-clock limit
+	Timeout time.Duration
+	// CPUTime is the CPU time limit, rounded up to whole seconds
+	CPUTime time.Duration
+	// MemoryBytes limits the program's data segment and heap
+	MemoryBytes int64
+	// OutputBytes limits stdout and stderr each
+	OutputBytes int
+	// FileSizeBytes limits the size of each file the program writes, rounded up to 512
+	// byte blocks
+	FileSizeBytes int64
+	// MaxProcesses limits the processes and threads of the server's user that may exist
+	// when the program or its children start another. The kernel counts per user, not
+	// per program, and does not apply the limit to root.
+	MaxProcesses int
+	// MaxConcurrent is the number of programs the executor runs at once. Further runs
+	// wait for one to finish, which does not count towards their timeout.
+	MaxConcurrent int
+}
+
+// Executor runs untrusted programs in separate local processes
+type Executor struct {
+	limits Limits
+	// isolation holds the namespace flags that cut programs off from the network, or is
+	// nil when the host does not allow creating them
+	isolation *isolation
+	// slots holds a token for each running program, or is nil when runs are not limited
+	slots chan struct{}
+}
+
+// New creates a new executor with the given limits. Network isolation is enabled if the
+// host supports it.
+func New(limits Limits) *Executor {
+	e := &Executor{limits: limits, isolation: probeIsolation()}
+	if limits.MaxConcurrent > 0 {
+		e.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return e
+}
+
+// NetworkIsolated reports whether programs run without network access
+func (e *Executor) NetworkIsolated() bool {
+	return e.isolation != nil
+}
+
+// Run executes a program in a fresh scratch directory that is removed afterwards.
+// A non-zero exit code, timeout or exceeded limit is reported in the Result, not as an
+// error; errors are reserved for failures to start the program at all.
+func (e *Executor) Run(ctx context.Context, req Request) (*Result, error) {
+	if len(req.Command) == 0 {
+		return nil, fmt.Errorf("no command given")
+	}
+
+	if e.slots != nil {
+		select {
+		case e.slots <- struct{}{}:
+			defer func() { <-e.slots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "clankerloop-exec-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range req.Files {
+		path := filepath.Join(dir, filepath.Clean("/"+name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create directory for %s: %w", name, err)
+		}
+		// Files are executable so that compiled programs can be run from them
+		if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = e.limits.Timeout
+	}
+	runCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, "/bin/sh", e.wrapperArgs(req.Command)...)
+	cmd.Dir = dir
+	// Start from an empty environment so no server secrets leak into the program
+	cmd.Env = append([]string{"PATH=/usr/local/bin:/usr/bin:/bin", "HOME=" + dir, "TMPDIR=" + dir}, req.Env...)
+	cmd.Stdin = bytes.NewReader(req.Stdin)
+	configureProcess(cmd, e.isolation)
+	// Kill the whole process group, so programs that fork cannot outlive the run
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = time.Second
+
+	var killOnce sync.Once
+	outputExceeded := func() {
+		killOnce.Do(func() { killProcessGroup(cmd) })
+	}
+	stdout := &cappedBuffer{limit: e.limits.OutputBytes, onExceed: outputExceeded}
+	stderr := &cappedBuffer{limit: e.limits.OutputBytes, onExceed: outputExceeded}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	result := &Result{
+		Stdout:              stdout.String(),
+		Stderr:              stderr.String(),
+		Duration:            time.Since(start),
+		OutputLimitExceeded: stdout.exceeded || stderr.exceeded,
+	}
+	if cmd.ProcessState != nil {
+		result.Usage = resourceUsage(cmd.ProcessState)
+		result.Signal = signalName(cmd.ProcessState)
+		result.CPULimitExceeded = cpuLimitExceeded(result, e.limits.CPUTime)
+	}
+	if len(req.Collect) > 0 {
+		result.Files = make(map[string]string, len(req.Collect))
+		for _, name := range req.Collect {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.Clean("/"+name)))
+			if err == nil {
+				result.Files[name] = string(data)
+			}
+		}
+	}
+
+	if runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		result.TimedOut = true
+		result.ExitCode = -1
+		return result, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	}
+	if err != nil && !errors.Is(err, exec.ErrWaitDelay) {
+		return nil, fmt.Errorf("failed to run %s: %w", req.Command[0], err)
+	}
+	return result, nil
+}
+
+// wrapperArgs runs command through the shell, which applies the resource limits to itself
+// with ulimit and then replaces itself with the program
+func (e *Executor) wrapperArgs(command []string) []string {
+	script := ""
+	if e.limits.CPUTime > 0 {
+		seconds := int64((e.limits.CPUTime + time.Second - 1) / time.Second)
+		script += "ulimit -t " + strconv.FormatInt(seconds, 10) + " && "
+	}
+	if e.limits.MemoryBytes > 0 {
+		script += "ulimit -d " + strconv.FormatInt(e.limits.MemoryBytes/1024, 10) + " && "
+	}
+	if e.limits.FileSizeBytes > 0 {
+		script += "ulimit -f " + strconv.FormatInt((e.limits.FileSizeBytes+511)/512, 10) + " && "
+	}
+	if e.limits.MaxProcesses > 0 {
+		script += "ulimit -u " + strconv.Itoa(e.limits.MaxProcesses) + " && "
+	}
+	script += `exec "$0" "$@"`
+	return append([]string{"-c", script}, command...)
+}
+
+// cappedBuffer collects output up to a limit and reports the first write past it
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	limit    int
+	exceeded bool
+	onExceed func()
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.limit <= 0 {
+		return b.buf.Write(p)
+	}
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		if !b.exceeded {
+			b.exceeded = true
+			b.onExceed()
+		}
+		// Report success so the copy keeps draining the pipe until the program is gone
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
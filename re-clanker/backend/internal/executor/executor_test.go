@@ -0,0 +1,100 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWrapperArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		want   string
+	}{
+		{"unlimited", Limits{}, `exec "$0" "$@"`},
+		{"CPU time rounds up", Limits{CPUTime: 1500 * time.Millisecond}, `ulimit -t 2 && exec "$0" "$@"`},
+		{"memory", Limits{MemoryBytes: 512 << 20}, `ulimit -d 524288 && exec "$0" "$@"`},
+		{"file size rounds up to blocks", Limits{FileSizeBytes: 1000}, `ulimit -f 2 && exec "$0" "$@"`},
+		{"processes", Limits{MaxProcesses: 64}, `ulimit -u 64 && exec "$0" "$@"`},
+		{
+			"all limits",
+			Limits{CPUTime: time.Second, MemoryBytes: 1 << 20, FileSizeBytes: 1 << 20, MaxProcesses: 8},
+			`ulimit -t 1 && ulimit -d 1024 && ulimit -f 2048 && ulimit -u 8 && exec "$0" "$@"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := (&Executor{limits: tt.limits}).wrapperArgs([]string{"prog", "arg"})
+			if len(args) != 4 || args[0] != "-c" || args[2] != "prog" || args[3] != "arg" {
+				t.Fatalf("wrapperArgs() = %q", args)
+			}
+			if args[1] != tt.want {
+				t.Errorf("script = %q, want %q", args[1], tt.want)
+			}
+		})
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		limit        time.Duration
+		reqTimeout   time.Duration
+		wantTimedOut bool
+	}{
+		{"zero timeout is unlimited", 0, 0, false},
+		{"default timeout", 50 * time.Millisecond, 0, true},
+		{"request overrides default", time.Hour, 50 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Executor{limits: Limits{Timeout: tt.limit}}
+			result, err := e.Run(context.Background(), Request{Command: []string{"sleep", "0.2"}, Timeout: tt.reqTimeout})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.TimedOut != tt.wantTimedOut {
+				t.Errorf("TimedOut = %v, want %v (%s)", result.TimedOut, tt.wantTimedOut, result.Failure())
+			}
+		})
+	}
+}
+
+func TestRunFileSizeLimit(t *testing.T) {
+	e := &Executor{limits: Limits{FileSizeBytes: 1024}}
+	result, err := e.Run(context.Background(), Request{
+		Command: []string{"sh", "-c", "head -c 4096 /dev/zero > out"},
+		Collect: []string{"out"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failure() == "" {
+		t.Fatal("writing past the file size limit succeeded")
+	}
+	if got := len(result.Files["out"]); got > 1024 {
+		t.Errorf("wrote %d bytes, want at most 1024", got)
+	}
+}
+
+func TestRunWaitsForSlot(t *testing.T) {
+	e := &Executor{slots: make(chan struct{}, 1)}
+	// Take the only slot, as a running program would
+	e.slots <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := e.Run(ctx, Request{Command: []string{"true"}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() with no free slot = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	<-e.slots
+	if _, err := e.Run(context.Background(), Request{Command: []string{"true"}}); err != nil {
+		t.Fatalf("Run() with a free slot = %v, want nil", err)
+	}
+	if len(e.slots) != 0 {
+		t.Errorf("%d slots held after the run, want 0", len(e.slots))
+	}
+}
@@ -0,0 +1,109 @@
+//go:build linux
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// isolation is the namespace setup that gives a program its own empty network stack
+type isolation struct {
+	cloneflags uintptr
+	userNS     bool
+}
+
+// probeIsolation finds namespace flags the host lets us use, by starting a trivial program
+// with them. An unprivileged server needs a user namespace to create a network namespace;
+// root may be denied user namespaces but can create the network namespace directly.
+func probeIsolation() *isolation {
+	for _, candidate := range []*isolation{
+		{cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET, userNS: true},
+		{cloneflags: syscall.CLONE_NEWNET},
+	} {
+		cmd := exec.Command("/bin/sh", "-c", "exit 0")
+		configureProcess(cmd, candidate)
+		if cmd.Run() == nil {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// configureProcess starts the program in its own process group and, if iso is set, in new
+// namespaces. Inside a user namespace the program keeps the server's uid and gid.
+func configureProcess(cmd *exec.Cmd, iso *isolation) {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if iso != nil {
+		attr.Cloneflags = iso.cloneflags
+		if iso.userNS {
+			attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+			attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+		}
+	}
+	cmd.SysProcAttr = attr
+}
+
+// killProcessGroup kills the program and everything it started
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func resourceUsage(state *os.ProcessState) ResourceUsage {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return ResourceUsage{}
+	}
+	return ResourceUsage{
+		UserTime:   time.Duration(rusage.Utime.Nano()),
+		SystemTime: time.Duration(rusage.Stime.Nano()),
+		// Linux reports the peak resident set size in kilobytes
+		MaxRSSBytes: rusage.Maxrss * 1024,
+	}
+}
+
+func signalName(state *os.ProcessState) string {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	if name, ok := signalNames[status.Signal()]; ok {
+		return name
+	}
+	return status.Signal().String()
+}
+
+// cpuLimitExceeded tells whether the kernel stopped the program for using up its CPU time,
+// with SIGXCPU or a SIGKILL the executor did not send. The kernel's accounting runs slightly
+// behind the usage reported afterwards, hence the margin.
+func cpuLimitExceeded(result *Result, limit time.Duration) bool {
+	if limit <= 0 || result.OutputLimitExceeded {
+		return false
+	}
+	switch result.Signal {
+	case "SIGXCPU":
+		return true
+	case "SIGKILL":
+		return result.Usage.UserTime+result.Usage.SystemTime >= limit.Truncate(time.Second)*9/10
+	}
+	return false
+}
+
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGXCPU: "SIGXCPU",
+	syscall.SIGXFSZ: "SIGXFSZ",
+}
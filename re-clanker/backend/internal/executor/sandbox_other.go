@@ -0,0 +1,37 @@
+//go:build !linux
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"time"
+)
+
+// isolation is unavailable outside Linux, so programs keep network access
+type isolation struct{}
+
+func probeIsolation() *isolation {
+	return nil
+}
+
+func configureProcess(cmd *exec.Cmd, iso *isolation) {}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+func resourceUsage(state *os.ProcessState) ResourceUsage {
+	return ResourceUsage{UserTime: state.UserTime(), SystemTime: state.SystemTime()}
+}
+
+func signalName(state *os.ProcessState) string {
+	return ""
+}
+
+func cpuLimitExceeded(result *Result, limit time.Duration) bool {
+	return false
+}
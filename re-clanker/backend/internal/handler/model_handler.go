@@ -1,9 +1,17 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
 
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/service"
+	"github.com/google/uuid"
 )
 
 // ModelHandler handles model-related HTTP requests
@@ -16,7 +24,7 @@ func NewModelHandler(modelRepo *repository.ModelRepository) *ModelHandler {
 	return &ModelHandler{modelRepo: modelRepo}
 }
 
-// ListModels handles GET /api/v1/models
+// ListModels handles GET /api/v1/models, listing active models
 func (h *ModelHandler) ListModels(w http.ResponseWriter, r *http.Request) {
 	models, err := h.modelRepo.List(r.Context())
 	if err != nil {
@@ -29,3 +37,185 @@ func (h *ModelHandler) ListModels(w http.ResponseWriter, r *http.Request) {
 		"models":  models,
 	})
 }
+
+// ListAllModels handles GET /api/v1/admin/models, listing inactive models too
+func (h *ModelHandler) ListAllModels(w http.ResponseWriter, r *http.Request) {
+	models, err := h.modelRepo.ListAll(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list models")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"models":  models,
+	})
+}
+
+// CreateModel handles POST /api/v1/admin/models
+func (h *ModelHandler) CreateModel(w http.ResponseWriter, r *http.Request) {
+	var model models.Model
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&model); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validateModel(&model); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.modelRepo.Create(r.Context(), &model)
+	if errors.Is(err, repository.ErrDuplicateModelName) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create model")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"model":   created,
+	})
+}
+
+// modelFields are the fields of a model that can be updated
+var modelFields = []string{
+	"name", "provider", "providerModel", "contextWindow", "promptPricePerToken",
+	"completionPricePerToken", "defaultParams", "allowedSteps", "isActive",
+}
+
+// UpdateModel handles PATCH /api/v1/admin/models/{id}. Fields missing from the body keep
+// their value and null clears optional fields.
+func (h *ModelHandler) UpdateModel(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil || len(body) == 0 {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	for key := range body {
+		if !slices.Contains(modelFields, key) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown model field: %s", key))
+			return
+		}
+	}
+
+	current, err := h.modelRepo.GetByID(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get model")
+		return
+	}
+	if current == nil {
+		writeError(w, http.StatusNotFound, "Model not found")
+		return
+	}
+
+	// Apply the body to the current model to validate the result as a whole. Default
+	// parameters are replaced rather than merged.
+	merged := *current
+	if _, ok := body["defaultParams"]; ok {
+		merged.DefaultParams = nil
+	}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validateModel(&merged); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fields := map[string]interface{}{
+		"name":                    merged.Name,
+		"provider":                merged.Provider,
+		"providerModel":           merged.ProviderModel,
+		"contextWindow":           merged.ContextWindow,
+		"promptPricePerToken":     merged.PromptPricePerToken,
+		"completionPricePerToken": merged.CompletionPricePerToken,
+		"defaultParams":           merged.DefaultParams,
+		"allowedSteps":            merged.AllowedSteps,
+		"isActive":                merged.IsActive,
+	}
+	updates := map[string]interface{}{}
+	for key := range body {
+		updates[key] = fields[key]
+	}
+	h.update(w, r, id, updates)
+}
+
+// DeactivateModel handles DELETE /api/v1/admin/models/{id}. The model stays in the catalog
+// for the problems and jobs that reference it, but cannot be chosen for new ones.
+func (h *ModelHandler) DeactivateModel(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid model ID")
+		return
+	}
+	h.update(w, r, id, map[string]interface{}{"isActive": false})
+}
+
+func (h *ModelHandler) update(w http.ResponseWriter, r *http.Request, id uuid.UUID, updates map[string]interface{}) {
+	model, err := h.modelRepo.Update(r.Context(), id, updates)
+	if errors.Is(err, repository.ErrDuplicateModelName) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update model")
+		return
+	}
+	if model == nil {
+		writeError(w, http.StatusNotFound, "Model not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"model":   model,
+	})
+}
+
+// validateModel checks the fields of a model before it is stored
+func validateModel(model *models.Model) error {
+	if model.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if model.Provider != nil && !slices.Contains(service.ProviderNames, *model.Provider) {
+		return fmt.Errorf("provider must be one of %v", service.ProviderNames)
+	}
+	if model.ContextWindow != nil && *model.ContextWindow <= 0 {
+		return fmt.Errorf("contextWindow must be positive")
+	}
+	if (model.PromptPricePerToken != nil && *model.PromptPricePerToken < 0) ||
+		(model.CompletionPricePerToken != nil && *model.CompletionPricePerToken < 0) {
+		return fmt.Errorf("prices must not be negative")
+	}
+	if params := model.DefaultParams; params != nil {
+		if params.MaxTokens != nil && *params.MaxTokens <= 0 {
+			return fmt.Errorf("defaultParams.maxTokens must be positive")
+		}
+		if params.Temperature != nil && *params.Temperature < 0 {
+			return fmt.Errorf("defaultParams.temperature must not be negative")
+		}
+	}
+	for _, step := range model.AllowedSteps {
+		if _, err := service.ParseGenerationStep(step); err != nil || step == "" {
+			return fmt.Errorf("allowedSteps contains an invalid step: %q", step)
+		}
+	}
+	return nil
+}
@@ -2,29 +2,44 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"time"
 
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/service"
 	"github.com/google/uuid"
 )
 
+// aiRequestTimeout bounds how long handlers that call the AI synchronously may take to respond
+const aiRequestTimeout = 3 * time.Minute
+
+// runRequestTimeout bounds how long handlers that run code synchronously may take to respond
+const runRequestTimeout = 5 * time.Minute
+
+// maxSubmissionBytes limits the size of request bodies carrying user code
+const maxSubmissionBytes = 1 << 20
+
 // ProblemHandler handles problem-related HTTP requests
 type ProblemHandler struct {
-	problemRepo *repository.ProblemRepository
-	focusRepo   *repository.FocusAreaRepository
-	jobRepo     *repository.GenerationJobRepository
+	problemRepo    *repository.ProblemRepository
+	focusRepo      *repository.FocusAreaRepository
+	problemService *service.ProblemService
 }
 
 // NewProblemHandler creates a new problem handler
 func NewProblemHandler(
 	problemRepo *repository.ProblemRepository,
 	focusRepo *repository.FocusAreaRepository,
-	jobRepo *repository.GenerationJobRepository,
+	problemService *service.ProblemService,
 ) *ProblemHandler {
 	return &ProblemHandler{
-		problemRepo: problemRepo,
-		focusRepo:   focusRepo,
-		jobRepo:     jobRepo,
+		problemRepo:    problemRepo,
+		focusRepo:      focusRepo,
+		problemService: problemService,
 	}
 }
 
@@ -32,6 +47,7 @@ func NewProblemHandler(
 func (h *ProblemHandler) CreateProblem(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		FocusAreaIDs []string `json:"focusAreaIds"`
+		Model        string   `json:"model"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -39,30 +55,32 @@ func (h *ProblemHandler) CreateProblem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create problem with default user ID (no auth)
-	problemID, err := h.problemRepo.Create(r.Context(), "", "", "", "default-user")
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create problem")
-		return
+	problem := repository.NewProblem{GeneratedByUserID: "default-user"}
+	if req.Model != "" {
+		model, ok := h.lookupModel(w, r, req.Model)
+		if !ok {
+			return
+		}
+		problem.GeneratedByModelID = &model.ID
 	}
 
 	// Link focus areas if provided
-	if len(req.FocusAreaIDs) > 0 {
-		focusAreaUUIDs := make([]uuid.UUID, 0, len(req.FocusAreaIDs))
-		for _, idStr := range req.FocusAreaIDs {
-			id, err := uuid.Parse(idStr)
-			if err == nil {
-				focusAreaUUIDs = append(focusAreaUUIDs, id)
-			}
-		}
-		if len(focusAreaUUIDs) > 0 {
-			h.focusRepo.LinkToProblem(r.Context(), problemID, focusAreaUUIDs)
+	for _, idStr := range req.FocusAreaIDs {
+		id, err := uuid.Parse(idStr)
+		if err == nil {
+			problem.FocusAreaIDs = append(problem.FocusAreaIDs, id)
 		}
 	}
 
-	// Create generation job
-	jobID, err := h.jobRepo.Create(r.Context(), problemID, nil)
+	// The problem and its generation job are created together
+	problemID, jobID, err := h.problemRepo.CreateWithJob(r.Context(), problem)
+	if errors.Is(err, repository.ErrUnknownFocusArea) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create generation job")
+		log.Printf("Failed to create problem: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to create problem")
 		return
 	}
 
@@ -94,9 +112,16 @@ func (h *ProblemHandler) GetProblem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	chain, err := h.problemService.DifficultyChain(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get difficulty chain")
+		return
+	}
+
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"problem": problem,
+		"success":         true,
+		"problem":         problem,
+		"difficultyChain": chain,
 	})
 }
 
@@ -140,6 +165,413 @@ func (h *ProblemHandler) GetProblemFocusAreas(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// GenerateProblem handles POST /api/v1/problems/:id/generate
+func (h *ProblemHandler) GenerateProblem(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		writeError(w, http.StatusBadRequest, "Missing problem ID")
+		return
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid problem ID")
+		return
+	}
+
+	var req struct {
+		StartingStep string `json:"startingStep"`
+		Model        string `json:"model"`
+		BypassCache  bool   `json:"bypassCache"`
+	}
+	// The body is optional; an empty body regenerates everything with the previous model
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	startingStep, err := service.ParseGenerationStep(req.StartingStep)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := h.problemRepo.GetByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	jobID, err := h.problemService.EnqueueGeneration(r.Context(), id, startingStep, req.Model, req.BypassCache)
+	switch {
+	case errors.Is(err, service.ErrUnknownModel):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, service.ErrGenerationInProgress), errors.Is(err, service.ErrMissingArtifacts):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to create generation job")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"success":      true,
+		"problemId":    id,
+		"jobId":        jobID,
+		"startingStep": startingStep,
+	})
+}
+
+// CreateVariant handles POST /api/v1/problems/:id/variants
+func (h *ProblemHandler) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		writeError(w, http.StatusBadRequest, "Missing problem ID")
+		return
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid problem ID")
+		return
+	}
+
+	var req struct {
+		Direction string `json:"direction"`
+		Model     string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Direction == "" {
+		req.Direction = r.URL.Query().Get("direction")
+	}
+
+	if _, err := h.problemRepo.GetByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	problemID, jobID, err := h.problemService.CreateVariant(r.Context(), id, req.Direction, req.Model, "default-user")
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidDirection), errors.Is(err, service.ErrUnknownModel):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrMissingArtifacts):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "Failed to create variant")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":   true,
+		"problemId": problemID,
+		"jobId":     jobID,
+		"direction": req.Direction,
+	})
+}
+
+// RewordProblem handles POST /api/v1/problems/:id/reword
+func (h *ProblemHandler) RewordProblem(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		writeError(w, http.StatusBadRequest, "Missing problem ID")
+		return
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid problem ID")
+		return
+	}
+
+	var req struct {
+		Model       string `json:"model"`
+		BypassCache bool   `json:"bypassCache"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	modelName := ""
+	if req.Model != "" {
+		model, ok := h.lookupModel(w, r, req.Model)
+		if !ok {
+			return
+		}
+		modelName = model.Name
+	}
+
+	if _, err := h.problemRepo.GetByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	// Generation takes longer than the server's default write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(aiRequestTimeout))
+
+	ctx := r.Context()
+	if req.BypassCache {
+		ctx = service.WithCacheBypass(ctx)
+	}
+	reworded, err := h.problemService.RewordProblemText(ctx, id, modelName)
+	switch {
+	case errors.Is(err, service.ErrMissingArtifacts):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		// Provider errors can carry internal details, so they are only logged
+		log.Printf("Failed to reword problem %s: %v", id, err)
+		writeError(w, http.StatusInternalServerError, "Failed to reword problem")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":             true,
+		"problemTextReworded": reworded,
+	})
+}
+
+// StreamProblemText handles POST /api/v1/problems/:id/problem-text/stream. It generates the
+// problem text and streams the model's output as server-sent events: "delta" events carry
+// {"text": ...}, followed by a "done" event with the stored result or an "error" event.
+func (h *ProblemHandler) StreamProblemText(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		writeError(w, http.StatusBadRequest, "Missing problem ID")
+		return
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid problem ID")
+		return
+	}
+
+	var req struct {
+		Model       string `json:"model"`
+		BypassCache bool   `json:"bypassCache"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	modelName := ""
+	if req.Model != "" {
+		model, ok := h.lookupModel(w, r, req.Model)
+		if !ok {
+			return
+		}
+		modelName = model.Name
+	}
+
+	if _, err := h.problemRepo.GetByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	stream := newSSEWriter(w, aiRequestTimeout)
+	ctx := r.Context()
+	if req.BypassCache {
+		ctx = service.WithCacheBypass(ctx)
+	}
+	result, err := h.problemService.StreamProblemText(ctx, id, modelName, func(delta string) error {
+		return stream.send("delta", map[string]string{"text": delta})
+	})
+	if err != nil {
+		// Provider errors can carry internal details, so they are only logged
+		log.Printf("Failed to stream problem text for %s: %v", id, err)
+		stream.send("error", map[string]string{"message": "Failed to generate problem text"})
+		return
+	}
+	stream.send("done", result)
+}
+
+// RunSubmission handles POST /api/v1/problems/:id/submissions/run. It runs the submitted
+// code against the problem's test cases and returns a graded result for each case.
+func (h *ProblemHandler) RunSubmission(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		writeError(w, http.StatusBadRequest, "Missing problem ID")
+		return
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid problem ID")
+		return
+	}
+
+	var req struct {
+		Code     string `json:"code"`
+		Language string `json:"language"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubmissionBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	if _, err := h.problemRepo.GetByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	// Running every test case can take longer than the server's default write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(runRequestTimeout))
+
+	result, err := h.problemService.RunSubmission(r.Context(), id, req.Code, req.Language)
+	switch {
+	case errors.Is(err, service.ErrUnsupportedLanguage):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, service.ErrUnsupportedRuntime):
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	case errors.Is(err, service.ErrMissingArtifacts):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to run submission")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"results": result.Results,
+		"passed":  result.Passed,
+		"total":   result.Total,
+	})
+}
+
+// RunCustomInputs handles POST /api/v1/problems/:id/submissions/run-custom. It runs the
+// submitted code and the reference solution on inputs given in the request and returns
+// both results for each input.
+func (h *ProblemHandler) RunCustomInputs(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		writeError(w, http.StatusBadRequest, "Missing problem ID")
+		return
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid problem ID")
+		return
+	}
+
+	var req struct {
+		Code         string        `json:"code"`
+		Language     string        `json:"language"`
+		CustomInputs []interface{} `json:"customInputs"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubmissionBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	if _, err := h.problemRepo.GetByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(runRequestTimeout))
+
+	results, err := h.problemService.RunCustomInputs(r.Context(), id, req.Code, req.Language, req.CustomInputs)
+	switch {
+	case errors.Is(err, service.ErrUnsupportedLanguage), errors.Is(err, service.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, service.ErrUnsupportedRuntime):
+		writeError(w, http.StatusNotImplemented, err.Error())
+		return
+	case errors.Is(err, service.ErrMissingArtifacts):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to run custom inputs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"results": results,
+	})
+}
+
+// GetStarterCode handles GET /api/v1/problems/:id/starter-code?language=. It returns stub
+// code for the problem's function, generated from its signature schema.
+func (h *ProblemHandler) GetStarterCode(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		writeError(w, http.StatusBadRequest, "Missing problem ID")
+		return
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid problem ID")
+		return
+	}
+
+	if _, err := h.problemRepo.GetByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+
+	language := r.URL.Query().Get("language")
+	if language == "" {
+		language = service.DefaultLanguage
+	}
+	code, err := h.problemService.StarterCode(r.Context(), id, language)
+	switch {
+	case errors.Is(err, service.ErrUnsupportedLanguage):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, service.ErrMissingArtifacts):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to generate starter code")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"language": language,
+		"code":     code,
+	})
+}
+
+// lookupModel resolves a model ID or name from a request. It writes an error response and
+// returns false if the model is not available.
+func (h *ProblemHandler) lookupModel(w http.ResponseWriter, r *http.Request, ref string) (*models.Model, bool) {
+	model, err := h.problemService.LookupModel(r.Context(), ref)
+	switch {
+	case errors.Is(err, service.ErrUnknownModel):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "Failed to look up model")
+		return nil, false
+	}
+	return model, true
+}
+
 // Helper functions
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
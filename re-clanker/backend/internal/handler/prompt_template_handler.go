@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/prompts"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+)
+
+// PromptTemplateHandler handles prompt template-related HTTP requests
+type PromptTemplateHandler struct {
+	templateRepo *repository.PromptTemplateRepository
+	renderer     *prompts.Renderer
+}
+
+// NewPromptTemplateHandler creates a new prompt template handler
+func NewPromptTemplateHandler(templateRepo *repository.PromptTemplateRepository, renderer *prompts.Renderer) *PromptTemplateHandler {
+	return &PromptTemplateHandler{
+		templateRepo: templateRepo,
+		renderer:     renderer,
+	}
+}
+
+// ListPromptTemplates handles GET /api/v1/prompt-templates
+func (h *PromptTemplateHandler) ListPromptTemplates(w http.ResponseWriter, r *http.Request) {
+	templates := make([]*prompts.Template, 0, len(prompts.Names))
+	for _, name := range prompts.Names {
+		t, err := h.renderer.Resolve(r.Context(), name)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to load prompt templates")
+			return
+		}
+		templates = append(templates, t)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"templates": templates,
+	})
+}
+
+// GetPromptTemplate handles GET /api/v1/prompt-templates/:name
+func (h *PromptTemplateHandler) GetPromptTemplate(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !prompts.IsKnown(name) {
+		writeError(w, http.StatusNotFound, "Prompt template not found")
+		return
+	}
+
+	effective, err := h.renderer.Resolve(r.Context(), name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load prompt template")
+		return
+	}
+	versions, err := h.templateRepo.ListVersions(r.Context(), name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load prompt template versions")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"template": effective,
+		"versions": versions,
+	})
+}
+
+// CreatePromptTemplateVersion handles POST /api/v1/prompt-templates/:name
+func (h *PromptTemplateHandler) CreatePromptTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !prompts.IsKnown(name) {
+		writeError(w, http.StatusNotFound, "Prompt template not found")
+		return
+	}
+
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Body == "" {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Reject templates that would fail at generation time
+	if err := prompts.Validate(name, req.Body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	template, err := h.templateRepo.CreateVersion(r.Context(), name, req.Body)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create prompt template")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"success":  true,
+		"template": template,
+	})
+}
+
+// UpdatePromptTemplateVersion handles PATCH /api/v1/prompt-templates/:name/versions/:version
+func (h *PromptTemplateHandler) UpdatePromptTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid template version")
+		return
+	}
+
+	var req struct {
+		IsActive *bool `json:"isActive"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.IsActive == nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.templateRepo.SetActive(r.Context(), name, version, *req.IsActive); err != nil {
+		writeError(w, http.StatusNotFound, "Prompt template not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sseWriter writes server-sent events to a response
+type sseWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// newSSEWriter starts a text/event-stream response. The write deadline is extended to
+// timeout, since streams outlive the server's default write timeout.
+func newSSEWriter(w http.ResponseWriter, timeout time.Duration) *sseWriter {
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(timeout))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	return &sseWriter{w: w, rc: rc}
+}
+
+// send writes one event with a JSON-encoded data payload and flushes it to the client
+func (s *sseWriter) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/service"
+	"github.com/google/uuid"
+)
+
+// UsageHandler handles AI usage reporting requests
+type UsageHandler struct {
+	usageRepo *repository.AIUsageRepository
+	aiService *service.AIService
+}
+
+// NewUsageHandler creates a new usage handler
+func NewUsageHandler(usageRepo *repository.AIUsageRepository, aiService *service.AIService) *UsageHandler {
+	return &UsageHandler{usageRepo: usageRepo, aiService: aiService}
+}
+
+// GetUsage handles GET /api/v1/usage?groupBy=day|model|focusArea|step
+// with optional from and to dates (YYYY-MM-DD, to is exclusive), problemId and jobId
+func (h *UsageHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	groupBy := query.Get("groupBy")
+	if groupBy == "" {
+		groupBy = repository.UsageByDay
+	}
+	switch groupBy {
+	case repository.UsageByDay, repository.UsageByModel, repository.UsageByFocusArea, repository.UsageByStep:
+	default:
+		writeError(w, http.StatusBadRequest, "groupBy must be one of day, model, focusArea or step")
+		return
+	}
+
+	var filter repository.UsageFilter
+	var err error
+	if filter.From, err = parseDateParam(query.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD")
+		return
+	}
+	if filter.To, err = parseDateParam(query.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD")
+		return
+	}
+	if filter.ProblemID, err = parseUUIDParam(query.Get("problemId")); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid problemId")
+		return
+	}
+	if filter.JobID, err = parseUUIDParam(query.Get("jobId")); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid jobId")
+		return
+	}
+
+	summaries, err := h.usageRepo.Summarize(r.Context(), groupBy, filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to summarize usage")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"groupBy": groupBy,
+		"usage":   summaries,
+	})
+}
+
+// GetCacheStats handles GET /api/v1/usage/cache
+func (h *UsageHandler) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"cache":   h.aiService.CacheStats(),
+	})
+}
+
+// parseDateParam parses an optional YYYY-MM-DD query parameter
+func parseDateParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseUUIDParam parses an optional UUID query parameter
+func parseUUIDParam(value string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
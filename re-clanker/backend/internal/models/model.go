@@ -6,10 +6,45 @@ import (
 	"github.com/google/uuid"
 )
 
-// Model represents an AI model in the system
+// Model represents an AI model in the catalog
 type Model struct {
 	ID   uuid.UUID `json:"id" db:"id"`
 	Name string    `json:"name" db:"name"`
+	// Provider serves the model, as ProviderModel. When nil, the configured provider chain
+	// serves it under Name.
+	Provider      *string `json:"provider" db:"provider"`
+	ProviderModel *string `json:"providerModel" db:"provider_model"`
+	ContextWindow *int    `json:"contextWindow" db:"context_window"`
+	// Prices in US dollars per token
+	PromptPricePerToken     *float64     `json:"promptPricePerToken" db:"prompt_price_per_token"`
+	CompletionPricePerToken *float64     `json:"completionPricePerToken" db:"completion_price_per_token"`
+	DefaultParams           *ModelParams `json:"defaultParams" db:"default_params"`
+	// AllowedSteps lists the pipeline steps the model may be used for; empty allows all
+	AllowedSteps []string  `json:"allowedSteps" db:"allowed_steps"`
+	IsActive     bool      `json:"isActive" db:"is_active"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt    time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// ModelParams are the generation parameters a model uses unless a request sets them
+type ModelParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"maxTokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+}
+
+// AllowsStep reports whether the model may be used for a pipeline step
+func (m *Model) AllowsStep(step string) bool {
+	if len(m.AllowedSteps) == 0 {
+		return true
+	}
+	for _, allowed := range m.AllowedSteps {
+		if allowed == step {
+			return true
+		}
+	}
+	return false
 }
 
 // Problem represents a coding problem
@@ -20,6 +55,7 @@ type Problem struct {
 	FunctionSignatureSchema map[string]interface{} `json:"functionSignatureSchema,omitempty" db:"function_signature_schema"`
 	ProblemTextReworded     string                 `json:"problemTextReworded" db:"problem_text_reworded"`
 	Solution                *string                `json:"solution,omitempty" db:"solution"`
+	SolutionLanguage        string                 `json:"solutionLanguage" db:"solution_language"`
 	GeneratedByModelID      *uuid.UUID             `json:"generatedByModelId,omitempty" db:"generated_by_model_id"`
 	GeneratedByUserID       string                 `json:"generatedByUserId" db:"generated_by_user_id"`
 	EasierThan              *uuid.UUID             `json:"easierThan,omitempty" db:"easier_than"`
@@ -30,16 +66,21 @@ type Problem struct {
 
 // TestCase represents a test case for a problem
 type TestCase struct {
-	ID           uuid.UUID              `json:"id" db:"id"`
-	ProblemID    uuid.UUID              `json:"problemId" db:"problem_id"`
-	Description  string                 `json:"description" db:"description"`
-	IsEdgeCase   bool                   `json:"isEdgeCase" db:"is_edge_case"`
-	IsSampleCase bool                   `json:"isSampleCase" db:"is_sample_case"`
-	InputCode    *string                `json:"inputCode,omitempty" db:"input_code"`
-	Input        map[string]interface{} `json:"input,omitempty" db:"input"`
-	Expected     map[string]interface{} `json:"expected,omitempty" db:"expected"`
-	CreatedAt    time.Time              `json:"createdAt" db:"created_at"`
-	UpdatedAt    time.Time              `json:"updatedAt" db:"updated_at"`
+	ID            uuid.UUID              `json:"id" db:"id"`
+	ProblemID     uuid.UUID              `json:"problemId" db:"problem_id"`
+	Description   string                 `json:"description" db:"description"`
+	IsEdgeCase    bool                   `json:"isEdgeCase" db:"is_edge_case"`
+	IsSampleCase  bool                   `json:"isSampleCase" db:"is_sample_case"`
+	InputCode     *string                `json:"inputCode,omitempty" db:"input_code"`
+	Input         map[string]interface{} `json:"input,omitempty" db:"input"`
+	Expected      interface{}            `json:"expected,omitempty" db:"expected"`
+	ExpectedError *string                `json:"expectedError,omitempty" db:"expected_error"`
+	CreatedAt     time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time              `json:"updatedAt" db:"updated_at"`
+
+	// HasExpected is set once an expected output is stored, which tells a null output
+	// apart from one that has not been produced yet
+	HasExpected bool `json:"-"`
 }
 
 // GenerationJob represents a problem generation job
@@ -51,8 +92,10 @@ type GenerationJob struct {
 	CurrentStep    *string    `json:"currentStep,omitempty" db:"current_step"`
 	CompletedSteps []string   `json:"completedSteps" db:"completed_steps"`
 	Error          *string    `json:"error,omitempty" db:"error"`
-	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
-	UpdatedAt      time.Time  `json:"updatedAt" db:"updated_at"`
+	// BypassCache makes the job's AI calls skip the completion cache
+	BypassCache bool      `json:"bypassCache" db:"bypass_cache"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
 }
 
 // FocusArea represents a problem focus area
@@ -88,8 +131,56 @@ type UserProblemAttempt struct {
 	UpdatedAt          time.Time `json:"updatedAt" db:"updated_at"`
 }
 
+// DifficultyLink is a problem's position in a chain of easier and harder variants.
+// EasierThan points at a problem that is easier than this one, HarderThan at a harder one.
+type DifficultyLink struct {
+	ProblemID  uuid.UUID  `json:"problemId"`
+	Level      int        `json:"level"`
+	EasierThan *uuid.UUID `json:"easierThan,omitempty"`
+	HarderThan *uuid.UUID `json:"harderThan,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
 // ProblemWithTestCases is a problem with its test cases
 type ProblemWithTestCases struct {
 	Problem
 	TestCases []TestCase `json:"testCases"`
 }
+
+// PromptTemplate is a versioned override of an embedded prompt template
+type PromptTemplate struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Version   int       `json:"version" db:"version"`
+	Body      string    `json:"body" db:"body"`
+	IsActive  bool      `json:"isActive" db:"is_active"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// AIUsage records the tokens, latency and estimated cost of a single AI call
+type AIUsage struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	JobID            *uuid.UUID `json:"jobId,omitempty" db:"job_id"`
+	ProblemID        *uuid.UUID `json:"problemId,omitempty" db:"problem_id"`
+	Step             *string    `json:"step,omitempty" db:"step"`
+	ModelID          *uuid.UUID `json:"modelId,omitempty" db:"model_id"`
+	Provider         string     `json:"provider" db:"provider"`
+	Model            string     `json:"model" db:"model"`
+	PromptTokens     int        `json:"promptTokens" db:"prompt_tokens"`
+	CompletionTokens int        `json:"completionTokens" db:"completion_tokens"`
+	LatencyMs        int        `json:"latencyMs" db:"latency_ms"`
+	CostUSD          *float64   `json:"costUsd,omitempty" db:"cost_usd"`
+	CreatedAt        time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// UsageSummary is AI usage rolled up under one key, such as a day or a model
+type UsageSummary struct {
+	Key              string  `json:"key"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	CostUSD          float64 `json:"costUsd"`
+	// UnpricedCalls counts calls without a known price, which are missing from CostUSD
+	UnpricedCalls int64   `json:"unpricedCalls"`
+	AvgLatencyMs  float64 `json:"avgLatencyMs"`
+}
@@ -0,0 +1,199 @@
+package prompts
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Template names, one per prompt used by the generation pipeline
+const (
+	GenerateProblemText       = "generate_problem_text"
+	ParseFunctionSignature    = "parse_function_signature"
+	GenerateTestCases         = "generate_test_cases"
+	GenerateTestCaseInputCode = "generate_test_case_input_code"
+	GenerateSolution          = "generate_solution"
+	RewordProblemText         = "reword_problem_text"
+)
+
+// Names lists every known template name
+var Names = []string{
+	GenerateProblemText,
+	ParseFunctionSignature,
+	GenerateTestCases,
+	GenerateTestCaseInputCode,
+	GenerateSolution,
+	RewordProblemText,
+}
+
+// Template sources, in the order they are consulted
+const (
+	SourceDatabase  = "database"
+	SourceDirectory = "directory"
+	SourceEmbedded  = "embedded"
+)
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+// Data is the input every template is rendered with
+type Data struct {
+	Problem    *models.ProblemWithTestCases
+	FocusAreas []models.FocusArea
+	// Language is the display name of the target programming language
+	Language string
+	// Vars holds step-specific values such as test case count bounds
+	Vars map[string]interface{}
+}
+
+// Template is the effective source of a named template
+type Template struct {
+	Name string `json:"name"`
+	// Version is the database version; 0 for directory and embedded templates
+	Version int    `json:"version"`
+	Source  string `json:"source"`
+	Body    string `json:"body"`
+}
+
+// Renderer resolves and renders prompt templates. A database version takes precedence
+// over a file in the override directory, which takes precedence over the embedded default.
+// Overrides are looked up on every render, so changes apply without a redeploy.
+type Renderer struct {
+	repo *repository.PromptTemplateRepository
+	dir  string
+}
+
+// NewRenderer creates a new renderer. repo and dir are optional.
+func NewRenderer(repo *repository.PromptTemplateRepository, dir string) *Renderer {
+	return &Renderer{repo: repo, dir: dir}
+}
+
+// Resolve returns the effective template for name
+func (r *Renderer) Resolve(ctx context.Context, name string) (*Template, error) {
+	if !IsKnown(name) {
+		return nil, fmt.Errorf("unknown prompt template: %s", name)
+	}
+
+	if r.repo != nil {
+		t, err := r.repo.GetActive(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			return &Template{Name: name, Version: t.Version, Source: SourceDatabase, Body: t.Body}, nil
+		}
+	}
+
+	if r.dir != "" {
+		body, err := os.ReadFile(filepath.Join(r.dir, name+".tmpl"))
+		if err == nil {
+			return &Template{Name: name, Source: SourceDirectory, Body: string(body)}, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read prompt template %s: %w", name, err)
+		}
+	}
+
+	body, err := embedded.ReadFile("templates/" + name + ".tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded prompt template %s: %w", name, err)
+	}
+	return &Template{Name: name, Source: SourceEmbedded, Body: string(body)}, nil
+}
+
+// Render renders the effective template for name with data
+func (r *Renderer) Render(ctx context.Context, name string, data *Data) (string, error) {
+	t, err := r.Resolve(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return execute(t.Name, t.Body, data)
+}
+
+// Validate checks that body parses and renders against sample data, so a broken
+// override is rejected before it reaches the pipeline
+func Validate(name, body string) error {
+	if !IsKnown(name) {
+		return fmt.Errorf("unknown prompt template: %s", name)
+	}
+	_, err := execute(name, body, sampleData())
+	return err
+}
+
+// IsKnown reports whether name is a known template name
+func IsKnown(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+var funcs = template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func execute(name, body string, data *Data) (string, error) {
+	t, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prompt template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// sampleData is representative template input used by Validate
+func sampleData() *Data {
+	inputCode := "print('{}')"
+	sampleCase := models.TestCase{
+		Description:  "Sum of a small array",
+		IsSampleCase: true,
+		InputCode:    &inputCode,
+		Input:        map[string]interface{}{"nums": []interface{}{1, 2, 3}},
+		Expected:     6,
+	}
+	return &Data{
+		Problem: &models.ProblemWithTestCases{
+			Problem: models.Problem{
+				ID:                  uuid.New(),
+				ProblemText:         "Given an array of integers, return its sum.",
+				FunctionSignature:   "function runSolution(nums: number[]): number",
+				ProblemTextReworded: "A merchant tallies coins.",
+				FunctionSignatureSchema: map[string]interface{}{
+					"version":      1,
+					"functionName": "runSolution",
+				},
+			},
+			TestCases: []models.TestCase{sampleCase},
+		},
+		FocusAreas: []models.FocusArea{
+			{Name: "Arrays & Strings", Slug: "arrays-strings", PromptGuidance: "Use arrays."},
+		},
+		Language: "Python",
+		Vars: map[string]interface{}{
+			"MinTestCases":    3,
+			"MaxTestCases":    30,
+			"SampleCases":     []models.TestCase{sampleCase},
+			"BaseProblemText": "Given an array of integers, return the largest element.",
+			"Direction":       "harder",
+		},
+	}
+}
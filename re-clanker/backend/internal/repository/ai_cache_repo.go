@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/database"
+	"github.com/jackc/pgx/v5"
+)
+
+// AICacheRepository handles database operations for cached AI completions
+type AICacheRepository struct {
+	db *database.DB
+}
+
+// NewAICacheRepository creates a new AI completion cache repository
+func NewAICacheRepository(db *database.DB) *AICacheRepository {
+	return &AICacheRepository{db: db}
+}
+
+// Get retrieves the cached response stored under key, or nil if there is none or it expired
+func (r *AICacheRepository) Get(ctx context.Context, key string) ([]byte, error) {
+	var response []byte
+	query := `
+		SELECT response
+		FROM ai_completion_cache
+		WHERE key = $1 AND (expires_at IS NULL OR expires_at > now())
+	`
+	err := r.db.Pool.QueryRow(ctx, query, key).Scan(&response)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached completion: %w", err)
+	}
+	return response, nil
+}
+
+// Put stores a response under key, replacing any previous entry. A zero ttl never expires.
+func (r *AICacheRepository) Put(ctx context.Context, key string, response []byte, ttl time.Duration) error {
+	var seconds *float64
+	if ttl > 0 {
+		s := ttl.Seconds()
+		seconds = &s
+	}
+	query := `
+		INSERT INTO ai_completion_cache (key, response, expires_at)
+		VALUES ($1, $2, now() + $3 * interval '1 second')
+		ON CONFLICT (key) DO UPDATE
+		SET response = EXCLUDED.response, created_at = now(), expires_at = EXCLUDED.expires_at
+	`
+	if _, err := r.db.Pool.Exec(ctx, query, key, response, seconds); err != nil {
+		return fmt.Errorf("failed to cache completion: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes expired entries and returns how many were removed
+func (r *AICacheRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := r.db.Pool.Exec(ctx, `DELETE FROM ai_completion_cache WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired completions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
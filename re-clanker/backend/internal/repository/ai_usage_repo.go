@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/database"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// AIUsageRepository handles database operations for AI usage records
+type AIUsageRepository struct {
+	db *database.DB
+}
+
+// NewAIUsageRepository creates a new AI usage repository
+func NewAIUsageRepository(db *database.DB) *AIUsageRepository {
+	return &AIUsageRepository{db: db}
+}
+
+// Create stores a usage record. If usage.ModelID is nil, it is looked up from requestedModel,
+// the model name the call asked for.
+func (r *AIUsageRepository) Create(ctx context.Context, usage *models.AIUsage, requestedModel string) error {
+	query := `
+		INSERT INTO ai_usage (job_id, problem_id, step, model_id, provider, model,
+		                      prompt_tokens, completion_tokens, latency_ms, cost_usd)
+		VALUES ($1, $2, $3, COALESCE($4, (SELECT id FROM models WHERE name = $5)), $6, $7, $8, $9, $10, $11)
+	`
+	_, err := r.db.Pool.Exec(ctx, query,
+		usage.JobID, usage.ProblemID, usage.Step, usage.ModelID, requestedModel,
+		usage.Provider, usage.Model, usage.PromptTokens, usage.CompletionTokens,
+		usage.LatencyMs, usage.CostUSD,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create AI usage record: %w", err)
+	}
+	return nil
+}
+
+// Usage groupings accepted by Summarize
+const (
+	UsageByDay       = "day"
+	UsageByModel     = "model"
+	UsageByFocusArea = "focusArea"
+	UsageByStep      = "step"
+)
+
+// UsageFilter restricts the records included in a usage summary
+type UsageFilter struct {
+	From      *time.Time
+	To        *time.Time
+	ProblemID *uuid.UUID
+	JobID     *uuid.UUID
+}
+
+// Summarize rolls usage records up by day, model, focus area or step. A call for a problem
+// with several focus areas counts towards each of them.
+func (r *AIUsageRepository) Summarize(ctx context.Context, groupBy string, filter UsageFilter) ([]models.UsageSummary, error) {
+	var key, join string
+	switch groupBy {
+	case UsageByDay:
+		key = "to_char(date_trunc('day', u.created_at), 'YYYY-MM-DD')"
+	case UsageByModel:
+		key = "u.model"
+	case UsageByFocusArea:
+		key = "COALESCE(fa.name, '')"
+		join = `
+			LEFT JOIN problem_focus_areas pfa ON pfa.problem_id = u.problem_id
+			LEFT JOIN focus_areas fa ON fa.id = pfa.focus_area_id`
+	case UsageByStep:
+		key = "COALESCE(u.step, '')"
+	default:
+		return nil, fmt.Errorf("unsupported usage grouping: %s", groupBy)
+	}
+
+	where := "WHERE TRUE"
+	args := []interface{}{}
+	argCount := 1
+	if filter.From != nil {
+		where += fmt.Sprintf(" AND u.created_at >= $%d", argCount)
+		args = append(args, *filter.From)
+		argCount++
+	}
+	if filter.To != nil {
+		where += fmt.Sprintf(" AND u.created_at < $%d", argCount)
+		args = append(args, *filter.To)
+		argCount++
+	}
+	if filter.ProblemID != nil {
+		where += fmt.Sprintf(" AND u.problem_id = $%d", argCount)
+		args = append(args, *filter.ProblemID)
+		argCount++
+	}
+	if filter.JobID != nil {
+		where += fmt.Sprintf(" AND u.job_id = $%d", argCount)
+		args = append(args, *filter.JobID)
+		argCount++
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %[1]s AS key,
+		       COUNT(*),
+		       COALESCE(SUM(u.prompt_tokens), 0),
+		       COALESCE(SUM(u.completion_tokens), 0),
+		       COALESCE(SUM(u.cost_usd), 0),
+		       COUNT(*) FILTER (WHERE u.cost_usd IS NULL),
+		       COALESCE(AVG(u.latency_ms), 0)
+		FROM ai_usage u %[2]s
+		%[3]s
+		GROUP BY %[1]s
+		ORDER BY %[1]s
+	`, key, join, where)
+
+	rows, err := r.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize AI usage: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []models.UsageSummary{}
+	for rows.Next() {
+		var s models.UsageSummary
+		if err := rows.Scan(&s.Key, &s.Calls, &s.PromptTokens, &s.CompletionTokens,
+			&s.CostUSD, &s.UnpricedCalls, &s.AvgLatencyMs); err != nil {
+			return nil, fmt.Errorf("failed to scan AI usage summary: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
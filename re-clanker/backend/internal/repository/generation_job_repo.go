@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/database"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
@@ -11,6 +13,10 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+// ErrActiveGenerationJob is returned when creating a job for a problem that already has a
+// pending or in-progress one
+var ErrActiveGenerationJob = errors.New("problem already has an active generation job")
+
 // GenerationJobRepository handles database operations for generation jobs
 type GenerationJobRepository struct {
 	db *database.DB
@@ -23,13 +29,33 @@ func NewGenerationJobRepository(db *database.DB) *GenerationJobRepository {
 
 // Create creates a new generation job
 func (r *GenerationJobRepository) Create(ctx context.Context, problemID uuid.UUID, modelID *uuid.UUID) (uuid.UUID, error) {
+	return r.CreateWithCompletedSteps(ctx, problemID, modelID, nil, false)
+}
+
+// CreateWithCompletedSteps creates a new generation job whose listed steps are already
+// marked complete, so the worker resumes after them. bypassCache makes the job's AI calls
+// skip the completion cache.
+func (r *GenerationJobRepository) CreateWithCompletedSteps(ctx context.Context, problemID uuid.UUID, modelID *uuid.UUID, completedSteps []string, bypassCache bool) (uuid.UUID, error) {
+	return createGenerationJob(ctx, r.db.Pool, problemID, modelID, completedSteps, bypassCache)
+}
+
+func createGenerationJob(ctx context.Context, q querier, problemID uuid.UUID, modelID *uuid.UUID, completedSteps []string, bypassCache bool) (uuid.UUID, error) {
+	if completedSteps == nil {
+		completedSteps = []string{}
+	}
+	completedStepsJSON, _ := json.Marshal(completedSteps)
+
 	var id uuid.UUID
 	query := `
-		INSERT INTO generation_jobs (problem_id, model_id, status, completed_steps)
-		VALUES ($1, $2, 'pending', '[]'::jsonb)
+		INSERT INTO generation_jobs (problem_id, model_id, status, completed_steps, bypass_cache)
+		VALUES ($1, $2, 'pending', $3, $4)
 		RETURNING id
 	`
-	err := r.db.Pool.QueryRow(ctx, query, problemID, modelID).Scan(&id)
+	err := q.QueryRow(ctx, query, problemID, modelID, completedStepsJSON, bypassCache).Scan(&id)
+	if isUniqueViolation(err) {
+		// generation_jobs_active_problem_idx allows one active job per problem
+		return uuid.Nil, ErrActiveGenerationJob
+	}
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to create generation job: %w", err)
 	}
@@ -41,13 +67,13 @@ func (r *GenerationJobRepository) GetByID(ctx context.Context, id uuid.UUID) (*m
 	var job models.GenerationJob
 	var completedStepsJSON []byte
 	query := `
-		SELECT id, problem_id, model_id, status, current_step, completed_steps, error, created_at, updated_at
+		SELECT id, problem_id, model_id, status, current_step, completed_steps, error, bypass_cache, created_at, updated_at
 		FROM generation_jobs
 		WHERE id = $1
 	`
 	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
 		&job.ID, &job.ProblemID, &job.ModelID, &job.Status, &job.CurrentStep,
-		&completedStepsJSON, &job.Error, &job.CreatedAt, &job.UpdatedAt,
+		&completedStepsJSON, &job.Error, &job.BypassCache, &job.CreatedAt, &job.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -72,7 +98,7 @@ func (r *GenerationJobRepository) GetLatestForProblem(ctx context.Context, probl
 	var job models.GenerationJob
 	var completedStepsJSON []byte
 	query := `
-		SELECT id, problem_id, model_id, status, current_step, completed_steps, error, created_at, updated_at
+		SELECT id, problem_id, model_id, status, current_step, completed_steps, error, bypass_cache, created_at, updated_at
 		FROM generation_jobs
 		WHERE problem_id = $1
 		ORDER BY created_at DESC
@@ -80,7 +106,7 @@ func (r *GenerationJobRepository) GetLatestForProblem(ctx context.Context, probl
 	`
 	err := r.db.Pool.QueryRow(ctx, query, problemID).Scan(
 		&job.ID, &job.ProblemID, &job.ModelID, &job.Status, &job.CurrentStep,
-		&completedStepsJSON, &job.Error, &job.CreatedAt, &job.UpdatedAt,
+		&completedStepsJSON, &job.Error, &job.BypassCache, &job.CreatedAt, &job.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -140,3 +166,61 @@ func (r *GenerationJobRepository) MarkStepComplete(ctx context.Context, id uuid.
 	}
 	return nil
 }
+
+// Heartbeat renews the lease of an in-progress job, so ClaimPending does not hand it to
+// another worker while it is still running
+func (r *GenerationJobRepository) Heartbeat(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE generation_jobs
+		SET updated_at = NOW()
+		WHERE id = $1 AND status = 'in_progress'
+	`
+	_, err := r.db.Pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to renew generation job lease: %w", err)
+	}
+	return nil
+}
+
+// ClaimPending atomically claims the oldest pending generation job and marks it in progress.
+// A job left in progress whose updated_at is older than lease is claimed too, since the
+// worker running it stopped without releasing it (e.g. the process crashed).
+// Concurrent workers never receive the same job thanks to FOR UPDATE SKIP LOCKED.
+// Returns nil if there is no job to claim.
+func (r *GenerationJobRepository) ClaimPending(ctx context.Context, lease time.Duration) (*models.GenerationJob, error) {
+	var job models.GenerationJob
+	var completedStepsJSON []byte
+	query := `
+		UPDATE generation_jobs
+		SET status = 'in_progress', error = NULL, updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM generation_jobs
+			WHERE status = 'pending'
+				OR (status = 'in_progress' AND updated_at < NOW() - make_interval(secs => $1))
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, problem_id, model_id, status, current_step, completed_steps, error, bypass_cache, created_at, updated_at
+	`
+	err := r.db.Pool.QueryRow(ctx, query, lease.Seconds()).Scan(
+		&job.ID, &job.ProblemID, &job.ModelID, &job.Status, &job.CurrentStep,
+		&completedStepsJSON, &job.Error, &job.BypassCache, &job.CreatedAt, &job.UpdatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim generation job: %w", err)
+	}
+
+	// Parse completed steps
+	if completedStepsJSON != nil {
+		json.Unmarshal(completedStepsJSON, &job.CompletedSteps)
+	}
+	if job.CompletedSteps == nil {
+		job.CompletedSteps = []string{}
+	}
+
+	return &job, nil
+}
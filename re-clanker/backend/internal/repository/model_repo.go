@@ -2,14 +2,20 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/database"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// ErrDuplicateModelName is returned when a model name is already in the catalog
+var ErrDuplicateModelName = errors.New("a model with this name already exists")
+
 // ModelRepository handles database operations for models
 type ModelRepository struct {
 	db *database.DB
@@ -20,48 +26,120 @@ func NewModelRepository(db *database.DB) *ModelRepository {
 	return &ModelRepository{db: db}
 }
 
-// Create creates a new model
-func (r *ModelRepository) Create(ctx context.Context, name string) (uuid.UUID, error) {
-	var id uuid.UUID
-	query := `INSERT INTO models (name) VALUES ($1) RETURNING id`
-	err := r.db.Pool.QueryRow(ctx, query, name).Scan(&id)
+const modelColumns = `id, name, provider, provider_model, context_window, prompt_price_per_token,
+	completion_price_per_token, default_params, allowed_steps, is_active, created_at, updated_at`
+
+// Create adds a model to the catalog and returns it as stored
+func (r *ModelRepository) Create(ctx context.Context, model *models.Model) (*models.Model, error) {
+	defaultParams, allowedSteps := modelJSON(model.DefaultParams, model.AllowedSteps)
+	query := `
+		INSERT INTO models (name, provider, provider_model, context_window, prompt_price_per_token,
+		                    completion_price_per_token, default_params, allowed_steps)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING ` + modelColumns
+	created, err := scanModel(r.db.Pool.QueryRow(ctx, query,
+		model.Name, model.Provider, model.ProviderModel, model.ContextWindow,
+		model.PromptPricePerToken, model.CompletionPricePerToken, defaultParams, allowedSteps,
+	))
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateModelName
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create model: %w", err)
+	}
+	return created, nil
+}
+
+// Update changes the given fields of a model and returns it, or nil if it does not exist.
+// Keys are the JSON field names of models.Model.
+func (r *ModelRepository) Update(ctx context.Context, id uuid.UUID, updates map[string]interface{}) (*models.Model, error) {
+	columns := map[string]string{
+		"name":                    "name",
+		"provider":                "provider",
+		"providerModel":           "provider_model",
+		"contextWindow":           "context_window",
+		"promptPricePerToken":     "prompt_price_per_token",
+		"completionPricePerToken": "completion_price_per_token",
+		"defaultParams":           "default_params",
+		"allowedSteps":            "allowed_steps",
+		"isActive":                "is_active",
+	}
+
+	query := "UPDATE models SET updated_at = NOW()"
+	args := []interface{}{}
+	argCount := 1
+	// Iterate in a fixed order so the same updates always build the same query
+	for _, key := range []string{
+		"name", "provider", "providerModel", "contextWindow", "promptPricePerToken",
+		"completionPricePerToken", "defaultParams", "allowedSteps", "isActive",
+	} {
+		val, ok := updates[key]
+		if !ok {
+			continue
+		}
+		switch v := val.(type) {
+		case *models.ModelParams:
+			val, _ = modelJSON(v, nil)
+		case []string:
+			_, val = modelJSON(nil, v)
+		}
+		query += fmt.Sprintf(", %s = $%d", columns[key], argCount)
+		args = append(args, val)
+		argCount++
+	}
+	query += fmt.Sprintf(" WHERE id = $%d RETURNING %s", argCount, modelColumns)
+	args = append(args, id)
+
+	model, err := scanModel(r.db.Pool.QueryRow(ctx, query, args...))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateModelName
+	}
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to create model: %w", err)
+		return nil, fmt.Errorf("failed to update model: %w", err)
 	}
-	return id, nil
+	return model, nil
 }
 
-// GetByID retrieves a model by ID
+// GetByID retrieves a model by ID, including inactive ones
 func (r *ModelRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Model, error) {
-	var model models.Model
-	query := `SELECT id, name FROM models WHERE id = $1`
-	err := r.db.Pool.QueryRow(ctx, query, id).Scan(&model.ID, &model.Name)
+	query := `SELECT ` + modelColumns + ` FROM models WHERE id = $1`
+	model, err := scanModel(r.db.Pool.QueryRow(ctx, query, id))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get model: %w", err)
 	}
-	return &model, nil
+	return model, nil
 }
 
-// GetByName retrieves a model by name
+// GetByName retrieves a model by name, including inactive ones
 func (r *ModelRepository) GetByName(ctx context.Context, name string) (*models.Model, error) {
-	var model models.Model
-	query := `SELECT id, name FROM models WHERE name = $1`
-	err := r.db.Pool.QueryRow(ctx, query, name).Scan(&model.ID, &model.Name)
+	query := `SELECT ` + modelColumns + ` FROM models WHERE name = $1`
+	model, err := scanModel(r.db.Pool.QueryRow(ctx, query, name))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get model by name: %w", err)
 	}
-	return &model, nil
+	return model, nil
 }
 
-// List lists all models
+// List lists active models
 func (r *ModelRepository) List(ctx context.Context) ([]models.Model, error) {
-	query := `SELECT id, name FROM models ORDER BY name`
+	return r.list(ctx, `SELECT `+modelColumns+` FROM models WHERE is_active = true ORDER BY name`)
+}
+
+// ListAll lists every model, including inactive ones
+func (r *ModelRepository) ListAll(ctx context.Context) ([]models.Model, error) {
+	return r.list(ctx, `SELECT `+modelColumns+` FROM models ORDER BY name`)
+}
+
+func (r *ModelRepository) list(ctx context.Context, query string) ([]models.Model, error) {
 	rows, err := r.db.Pool.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list models: %w", err)
@@ -70,11 +148,60 @@ func (r *ModelRepository) List(ctx context.Context) ([]models.Model, error) {
 
 	var modelsList []models.Model
 	for rows.Next() {
-		var model models.Model
-		if err := rows.Scan(&model.ID, &model.Name); err != nil {
+		model, err := scanModel(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan model: %w", err)
 		}
-		modelsList = append(modelsList, model)
+		modelsList = append(modelsList, *model)
 	}
 	return modelsList, nil
 }
+
+// scanModel scans a row selected with modelColumns
+func scanModel(row pgx.Row) (*models.Model, error) {
+	var model models.Model
+	var defaultParamsJSON, allowedStepsJSON []byte
+	err := row.Scan(
+		&model.ID, &model.Name, &model.Provider, &model.ProviderModel, &model.ContextWindow,
+		&model.PromptPricePerToken, &model.CompletionPricePerToken, &defaultParamsJSON,
+		&allowedStepsJSON, &model.IsActive, &model.CreatedAt, &model.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if defaultParamsJSON != nil {
+		json.Unmarshal(defaultParamsJSON, &model.DefaultParams)
+	}
+	if allowedStepsJSON != nil {
+		json.Unmarshal(allowedStepsJSON, &model.AllowedSteps)
+	}
+	if model.AllowedSteps == nil {
+		model.AllowedSteps = []string{}
+	}
+	return &model, nil
+}
+
+// modelJSON encodes the JSON columns of a model. Nil default parameters stay NULL and nil
+// allowed steps become an empty list.
+func modelJSON(defaultParams *models.ModelParams, allowedSteps []string) ([]byte, []byte) {
+	var defaultParamsJSON []byte
+	if defaultParams != nil {
+		defaultParamsJSON, _ = json.Marshal(defaultParams)
+	}
+	if allowedSteps == nil {
+		allowedSteps = []string{}
+	}
+	allowedStepsJSON, _ := json.Marshal(allowedSteps)
+	return defaultParamsJSON, allowedStepsJSON
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
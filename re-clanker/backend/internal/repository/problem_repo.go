@@ -3,12 +3,14 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/database"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 // ProblemRepository handles database operations for problems
@@ -36,6 +38,61 @@ func (r *ProblemRepository) Create(ctx context.Context, problemText, functionSig
 	return id, nil
 }
 
+// NewProblem describes a problem to create along with its first generation job
+type NewProblem struct {
+	GeneratedByUserID  string
+	GeneratedByModelID *uuid.UUID
+	// EasierThan or HarderThan link a variant to the problem it was derived from
+	EasierThan   *uuid.UUID
+	HarderThan   *uuid.UUID
+	FocusAreaIDs []uuid.UUID
+}
+
+// ErrUnknownFocusArea is returned when a new problem names a focus area that does not exist
+var ErrUnknownFocusArea = errors.New("unknown focus area")
+
+// CreateWithJob creates an empty problem, links its focus areas and queues a generation job
+// for it in a single transaction, so a problem never exists without its job
+func (r *ProblemRepository) CreateWithJob(ctx context.Context, p NewProblem) (uuid.UUID, uuid.UUID, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var problemID uuid.UUID
+	query := `
+		INSERT INTO problems (problem_text, function_signature, problem_text_reworded, generated_by_user_id,
+			generated_by_model_id, easier_than, harder_than)
+		VALUES ('', '', '', $1, $2, $3, $4)
+		RETURNING id
+	`
+	err = tx.QueryRow(ctx, query, p.GeneratedByUserID, p.GeneratedByModelID, p.EasierThan, p.HarderThan).Scan(&problemID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to create problem: %w", err)
+	}
+
+	for _, focusAreaID := range p.FocusAreaIDs {
+		_, err := tx.Exec(ctx, `INSERT INTO problem_focus_areas (problem_id, focus_area_id) VALUES ($1, $2)`, problemID, focusAreaID)
+		if isForeignKeyViolation(err) {
+			return uuid.Nil, uuid.Nil, fmt.Errorf("%w: %s", ErrUnknownFocusArea, focusAreaID)
+		}
+		if err != nil {
+			return uuid.Nil, uuid.Nil, fmt.Errorf("failed to link focus area to problem: %w", err)
+		}
+	}
+
+	jobID, err := createGenerationJob(ctx, tx, problemID, p.GeneratedByModelID, nil, false)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to commit problem: %w", err)
+	}
+	return problemID, jobID, nil
+}
+
 // GetByID retrieves a problem by ID with its test cases
 func (r *ProblemRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.ProblemWithTestCases, error) {
 	// Get problem
@@ -43,14 +100,14 @@ func (r *ProblemRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 	var functionSignatureSchema []byte
 	query := `
 		SELECT id, problem_text, function_signature, function_signature_schema,
-		       problem_text_reworded, solution, generated_by_model_id,
+		       problem_text_reworded, solution, solution_language, generated_by_model_id,
 		       generated_by_user_id, easier_than, harder_than, created_at, updated_at
 		FROM problems
 		WHERE id = $1
 	`
 	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
 		&problem.ID, &problem.ProblemText, &problem.FunctionSignature, &functionSignatureSchema,
-		&problem.ProblemTextReworded, &problem.Solution, &problem.GeneratedByModelID,
+		&problem.ProblemTextReworded, &problem.Solution, &problem.SolutionLanguage, &problem.GeneratedByModelID,
 		&problem.GeneratedByUserID, &problem.EasierThan, &problem.HarderThan,
 		&problem.CreatedAt, &problem.UpdatedAt,
 	)
@@ -114,11 +171,26 @@ func (r *ProblemRepository) Update(ctx context.Context, id uuid.UUID, updates ma
 		args = append(args, val)
 		argCount++
 	}
+	if val, ok := updates["solutionLanguage"]; ok {
+		query += fmt.Sprintf(", solution_language = $%d", argCount)
+		args = append(args, val)
+		argCount++
+	}
 	if val, ok := updates["generatedByModelId"]; ok {
 		query += fmt.Sprintf(", generated_by_model_id = $%d", argCount)
 		args = append(args, val)
 		argCount++
 	}
+	if val, ok := updates["easierThan"]; ok {
+		query += fmt.Sprintf(", easier_than = $%d", argCount)
+		args = append(args, val)
+		argCount++
+	}
+	if val, ok := updates["harderThan"]; ok {
+		query += fmt.Sprintf(", harder_than = $%d", argCount)
+		args = append(args, val)
+		argCount++
+	}
 
 	query += fmt.Sprintf(" WHERE id = $%d", argCount)
 	args = append(args, id)
@@ -130,6 +202,41 @@ func (r *ProblemRepository) Update(ctx context.Context, id uuid.UUID, updates ma
 	return nil
 }
 
+// GetDifficultyLinks returns the difficulty links of every problem connected to the given
+// problem through easier_than or harder_than, in either direction
+func (r *ProblemRepository) GetDifficultyLinks(ctx context.Context, id uuid.UUID) ([]models.DifficultyLink, error) {
+	query := `
+		WITH RECURSIVE chain(id) AS (
+			SELECT $1::uuid
+			UNION
+			SELECT n.id
+			FROM chain c
+			JOIN problems p ON p.id = c.id OR p.easier_than = c.id OR p.harder_than = c.id
+			CROSS JOIN LATERAL (VALUES (p.id), (p.easier_than), (p.harder_than)) AS n(id)
+			WHERE n.id IS NOT NULL
+		)
+		SELECT p.id, p.easier_than, p.harder_than, p.created_at
+		FROM problems p
+		JOIN chain c ON c.id = p.id
+		ORDER BY p.created_at
+	`
+	rows, err := r.db.Pool.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get difficulty links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []models.DifficultyLink
+	for rows.Next() {
+		var link models.DifficultyLink
+		if err := rows.Scan(&link.ProblemID, &link.EasierThan, &link.HarderThan, &link.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan difficulty link: %w", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
 // List lists all problem IDs
 func (r *ProblemRepository) List(ctx context.Context) ([]uuid.UUID, error) {
 	query := `SELECT id FROM problems ORDER BY created_at DESC`
@@ -154,7 +261,7 @@ func (r *ProblemRepository) List(ctx context.Context) ([]uuid.UUID, error) {
 func (r *ProblemRepository) getTestCases(ctx context.Context, problemID uuid.UUID) ([]models.TestCase, error) {
 	query := `
 		SELECT id, problem_id, description, is_edge_case, is_sample_case,
-		       input_code, input, expected, created_at, updated_at
+		       input_code, input, expected, expected_error, created_at, updated_at
 		FROM test_cases
 		WHERE problem_id = $1
 		ORDER BY created_at
@@ -171,7 +278,7 @@ func (r *ProblemRepository) getTestCases(ctx context.Context, problemID uuid.UUI
 		var inputJSON, expectedJSON []byte
 		err := rows.Scan(
 			&tc.ID, &tc.ProblemID, &tc.Description, &tc.IsEdgeCase, &tc.IsSampleCase,
-			&tc.InputCode, &inputJSON, &expectedJSON, &tc.CreatedAt, &tc.UpdatedAt,
+			&tc.InputCode, &inputJSON, &expectedJSON, &tc.ExpectedError, &tc.CreatedAt, &tc.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan test case: %w", err)
@@ -181,8 +288,10 @@ func (r *ProblemRepository) getTestCases(ctx context.Context, problemID uuid.UUI
 		if inputJSON != nil {
 			json.Unmarshal(inputJSON, &tc.Input)
 		}
+		// SQL NULL means no output yet, while jsonb null is a null output
 		if expectedJSON != nil {
 			json.Unmarshal(expectedJSON, &tc.Expected)
+			tc.HasExpected = true
 		}
 
 		testCases = append(testCases, tc)
@@ -192,16 +301,63 @@ func (r *ProblemRepository) getTestCases(ctx context.Context, problemID uuid.UUI
 
 // CreateTestCase creates a new test case
 func (r *ProblemRepository) CreateTestCase(ctx context.Context, tc models.TestCase) (uuid.UUID, error) {
+	return createTestCase(ctx, r.db.Pool, tc)
+}
+
+// DeleteTestCases deletes all test cases for a problem
+func (r *ProblemRepository) DeleteTestCases(ctx context.Context, problemID uuid.UUID) error {
+	return deleteTestCases(ctx, r.db.Pool, problemID)
+}
+
+// ReplaceTestCases deletes a problem's test cases and inserts the given ones in a
+// single transaction, so readers never observe a partially replaced set
+func (r *ProblemRepository) ReplaceTestCases(ctx context.Context, problemID uuid.UUID, testCases []models.TestCase) ([]uuid.UUID, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := deleteTestCases(ctx, tx, problemID); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(testCases))
+	for _, tc := range testCases {
+		tc.ProblemID = problemID
+		id, err := createTestCase(ctx, tx, tc)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit test cases: %w", err)
+	}
+	return ids, nil
+}
+
+// querier is implemented by both the connection pool and a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func createTestCase(ctx context.Context, q querier, tc models.TestCase) (uuid.UUID, error) {
 	var id uuid.UUID
 	inputJSON, _ := json.Marshal(tc.Input)
-	expectedJSON, _ := json.Marshal(tc.Expected)
+	var expectedJSON []byte
+	if tc.HasExpected {
+		expectedJSON, _ = json.Marshal(tc.Expected)
+	}
 
 	query := `
 		INSERT INTO test_cases (problem_id, description, is_edge_case, is_sample_case, input_code, input, expected)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id
 	`
-	err := r.db.Pool.QueryRow(ctx, query,
+	err := q.QueryRow(ctx, query,
 		tc.ProblemID, tc.Description, tc.IsEdgeCase, tc.IsSampleCase,
 		tc.InputCode, inputJSON, expectedJSON,
 	).Scan(&id)
@@ -211,10 +367,9 @@ func (r *ProblemRepository) CreateTestCase(ctx context.Context, tc models.TestCa
 	return id, nil
 }
 
-// DeleteTestCases deletes all test cases for a problem
-func (r *ProblemRepository) DeleteTestCases(ctx context.Context, problemID uuid.UUID) error {
+func deleteTestCases(ctx context.Context, q querier, problemID uuid.UUID) error {
 	query := `DELETE FROM test_cases WHERE problem_id = $1`
-	_, err := r.db.Pool.Exec(ctx, query, problemID)
+	_, err := q.Exec(ctx, query, problemID)
 	if err != nil {
 		return fmt.Errorf("failed to delete test cases: %w", err)
 	}
@@ -234,3 +389,40 @@ func (r *ProblemRepository) GetMostRecentByUser(ctx context.Context, userID stri
 	}
 	return &id, nil
 }
+
+// UpdateTestCaseInputCode sets the input generator code for a test case
+func (r *ProblemRepository) UpdateTestCaseInputCode(ctx context.Context, id uuid.UUID, inputCode string) error {
+	query := `UPDATE test_cases SET input_code = $1, updated_at = NOW() WHERE id = $2`
+	_, err := r.db.Pool.Exec(ctx, query, inputCode, id)
+	if err != nil {
+		return fmt.Errorf("failed to update test case input code: %w", err)
+	}
+	return nil
+}
+
+// UpdateTestCaseInput sets the generated input for a test case
+func (r *ProblemRepository) UpdateTestCaseInput(ctx context.Context, id uuid.UUID, input map[string]interface{}) error {
+	inputJSON, _ := json.Marshal(input)
+	query := `UPDATE test_cases SET input = $1, updated_at = NOW() WHERE id = $2`
+	_, err := r.db.Pool.Exec(ctx, query, inputJSON, id)
+	if err != nil {
+		return fmt.Errorf("failed to update test case input: %w", err)
+	}
+	return nil
+}
+
+// UpdateTestCaseExpected stores the reference output for a test case. When the reference
+// solution failed, expected is nil and expectedErr explains why; otherwise a nil expected
+// is stored as a JSON null output.
+func (r *ProblemRepository) UpdateTestCaseExpected(ctx context.Context, id uuid.UUID, expected interface{}, expectedErr *string) error {
+	var expectedJSON []byte
+	if expectedErr == nil {
+		expectedJSON, _ = json.Marshal(expected)
+	}
+	query := `UPDATE test_cases SET expected = $1, expected_error = $2, updated_at = NOW() WHERE id = $3`
+	_, err := r.db.Pool.Exec(ctx, query, expectedJSON, expectedErr, id)
+	if err != nil {
+		return fmt.Errorf("failed to update test case expected output: %w", err)
+	}
+	return nil
+}
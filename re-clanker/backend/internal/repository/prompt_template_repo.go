@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/database"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// PromptTemplateRepository handles database operations for prompt templates
+type PromptTemplateRepository struct {
+	db *database.DB
+}
+
+// NewPromptTemplateRepository creates a new prompt template repository
+func NewPromptTemplateRepository(db *database.DB) *PromptTemplateRepository {
+	return &PromptTemplateRepository{db: db}
+}
+
+// GetActive retrieves the newest active version of a template, or nil if there is none
+func (r *PromptTemplateRepository) GetActive(ctx context.Context, name string) (*models.PromptTemplate, error) {
+	var t models.PromptTemplate
+	query := `
+		SELECT id, name, version, body, is_active, created_at
+		FROM prompt_templates
+		WHERE name = $1 AND is_active = true
+		ORDER BY version DESC
+		LIMIT 1
+	`
+	err := r.db.Pool.QueryRow(ctx, query, name).Scan(&t.ID, &t.Name, &t.Version, &t.Body, &t.IsActive, &t.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prompt template: %w", err)
+	}
+	return &t, nil
+}
+
+// ListVersions lists all stored versions of a template, newest first
+func (r *PromptTemplateRepository) ListVersions(ctx context.Context, name string) ([]models.PromptTemplate, error) {
+	query := `
+		SELECT id, name, version, body, is_active, created_at
+		FROM prompt_templates
+		WHERE name = $1
+		ORDER BY version DESC
+	`
+	rows, err := r.db.Pool.Query(ctx, query, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []models.PromptTemplate
+	for rows.Next() {
+		var t models.PromptTemplate
+		if err := rows.Scan(&t.ID, &t.Name, &t.Version, &t.Body, &t.IsActive, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan prompt template: %w", err)
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// CreateVersion stores a template body as the next version of name and returns it
+func (r *PromptTemplateRepository) CreateVersion(ctx context.Context, name, body string) (*models.PromptTemplate, error) {
+	var t models.PromptTemplate
+	query := `
+		INSERT INTO prompt_templates (name, version, body)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2
+		FROM prompt_templates
+		WHERE name = $1
+		RETURNING id, name, version, body, is_active, created_at
+	`
+	err := r.db.Pool.QueryRow(ctx, query, name, body).Scan(&t.ID, &t.Name, &t.Version, &t.Body, &t.IsActive, &t.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create prompt template: %w", err)
+	}
+	return &t, nil
+}
+
+// SetActive activates or deactivates one version of a template
+func (r *PromptTemplateRepository) SetActive(ctx context.Context, name string, version int, active bool) error {
+	query := `UPDATE prompt_templates SET is_active = $1 WHERE name = $2 AND version = $3`
+	tag, err := r.db.Pool.Exec(ctx, query, active, name, version)
+	if err != nil {
+		return fmt.Errorf("failed to update prompt template: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("prompt template not found: %s v%d", name, version)
+	}
+	return nil
+}
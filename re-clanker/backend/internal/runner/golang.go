@@ -0,0 +1,292 @@
+package runner
+
+import (
+	"fmt"
+	"go/format"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+)
+
+// goHarness decodes each positional argument read from stdin into the type of the
+// corresponding parameter, calls the function and prints the JSON-encoded return value.
+// Missing trailing arguments are zero values. A trailing error result that is not nil
+// fails the run.
+const goHarness = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+)
+
+func main() {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(os.Stdin).Decode(&raw); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to read arguments:", err)
+		os.Exit(2)
+	}
+
+	fn := reflect.ValueOf({{.FunctionName}})
+	t := fn.Type()
+	if len(raw) > t.NumIn() {
+		fmt.Fprintf(os.Stderr, "got %d arguments, {{.FunctionName}} takes %d\n", len(raw), t.NumIn())
+		os.Exit(2)
+	}
+	args := make([]reflect.Value, t.NumIn())
+	for i := range args {
+		arg := reflect.New(t.In(i))
+		if i < len(raw) {
+			if err := json.Unmarshal(raw[i], arg.Interface()); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to decode argument %d: %v\n", i+1, err)
+				os.Exit(2)
+			}
+		}
+		args[i] = arg.Elem()
+	}
+
+	var out []reflect.Value
+	if t.IsVariadic() {
+		out = fn.CallSlice(args)
+	} else {
+		out = fn.Call(args)
+	}
+	if n := len(out); n > 0 && t.Out(n-1) == reflect.TypeOf((*error)(nil)).Elem() {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		out = out[:n-1]
+	}
+
+	var result any
+	if len(out) > 0 {
+		result = out[0].Interface()
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to encode result:", err)
+		os.Exit(2)
+	}
+	fmt.Print("\n{{.ResultMarker}}" + string(data) + "\n")
+}
+`
+
+// goBuildTimeout allows for filling an empty build cache, which compiles the standard
+// library packages the harness uses
+const goBuildTimeout = 2 * time.Minute
+
+// newGoRunner creates the runner for Go. Solutions are compiled once and the binary then
+// runs on each input. The module lives in a subdirectory because the go command ignores a
+// go.mod in the temporary directory, which is the scratch directory.
+func newGoRunner(cacheDir string) *Runner {
+	env := []string{"GOTOOLCHAIN=local", "CGO_ENABLED=0", "GOPROXY=off", "GOFLAGS=-mod=mod", "GOTELEMETRY=off"}
+	if cacheDir != "" {
+		if abs, err := filepath.Abs(cacheDir); err == nil {
+			cacheDir = abs
+		}
+		env = append(env, "GOCACHE="+cacheDir)
+	}
+	return &Runner{
+		Language:     Go,
+		Name:         "Go",
+		SolutionFile: "src/solution.go",
+		HarnessFile:  "src/main.go",
+		Build:        []string{lookPath("go"), "-C", "src", "build", "-o", "../program", "."},
+		BuildEnv:     env,
+		BuildTimeout: goBuildTimeout,
+		Program:      "program",
+		files:        map[string]string{"src/go.mod": "module solution\n\ngo 1.22\n"},
+		harness:      harnessTemplate("go", goHarness),
+		prepare:      prepareGo,
+		starter:      goStarter,
+	}
+}
+
+var goPackageClause = regexp.MustCompile(`(?m)^package\s+\w+[ \t]*$`)
+
+// prepareGo puts the solution in package main, next to the harness
+func prepareGo(code string, schema *signature.FunctionSignatureSchema) string {
+	if loc := goPackageClause.FindStringIndex(code); loc != nil {
+		return code[:loc[0]] + "package main" + code[loc[1]:] + "\n"
+	}
+	return "package main\n\n" + code + "\n"
+}
+
+var goKeywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true, "default": true,
+	"defer": true, "else": true, "fallthrough": true, "for": true, "func": true, "go": true,
+	"goto": true, "if": true, "import": true, "interface": true, "map": true, "package": true,
+	"range": true, "return": true, "select": true, "struct": true, "switch": true, "type": true,
+	"var": true,
+}
+
+// goStarter declares named object types as structs and the function with typed
+// parameters. Optional parameters and nullable values are pointers.
+func goStarter(schema *signature.FunctionSignatureSchema) string {
+	g := goTypes{schema: schema}
+	var b strings.Builder
+	b.WriteString("package main\n\n")
+	for _, nt := range schema.NamedTypes {
+		if nt.Description != "" {
+			fmt.Fprintf(&b, "// %s\n", nt.Description)
+		}
+		if nt.Definition != nil && nt.Definition.Kind == signature.KindObject {
+			fmt.Fprintf(&b, "type %s struct {\n", nt.Name)
+			for _, field := range g.fields(nt.Definition) {
+				fmt.Fprintf(&b, "\t%s\n", field)
+			}
+			b.WriteString("}\n\n")
+		} else {
+			fmt.Fprintf(&b, "type %s %s\n\n", nt.Name, g.typ(nt.Definition))
+		}
+	}
+
+	if docs := paramDocs(schema); len(docs) > 0 {
+		fmt.Fprintf(&b, "// %s is called with:\n", schema.FunctionName)
+		for _, doc := range docs {
+			fmt.Fprintf(&b, "//   - %s: %s\n", goParamName(doc[0]), doc[1])
+		}
+	}
+	params := make([]string, len(schema.Parameters))
+	for i, p := range schema.Parameters {
+		typ := g.typ(p.Type)
+		if p.Optional {
+			typ = nullable(typ)
+		}
+		params[i] = goParamName(p.Name) + " " + typ
+	}
+	fmt.Fprintf(&b, "func %s(%s) %s {\n", schema.FunctionName, strings.Join(params, ", "), g.typ(schema.ReturnType))
+	b.WriteString("\tpanic(\"not implemented\")\n}\n")
+
+	code, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return b.String()
+	}
+	return string(code)
+}
+
+func goParamName(name string) string {
+	if goKeywords[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// goTypes renders Go types for a schema
+type goTypes struct {
+	schema *signature.FunctionSignatureSchema
+}
+
+func (g goTypes) typ(t *signature.TypeDef) string {
+	if t == nil {
+		return "any"
+	}
+	switch t.Kind {
+	case signature.KindPrimitive:
+		switch t.Primitive {
+		case signature.PrimitiveInt:
+			return "int"
+		case signature.PrimitiveFloat:
+			return "float64"
+		case signature.PrimitiveString:
+			return "string"
+		case signature.PrimitiveBoolean:
+			return "bool"
+		}
+	case signature.KindArray:
+		return "[]" + g.typ(t.Items)
+	case signature.KindTuple:
+		// A tuple of one type is a fixed-size array; others have no Go equivalent
+		if len(t.Elements) == 0 {
+			return "[]any"
+		}
+		first := g.typ(t.Elements[0])
+		for _, e := range t.Elements[1:] {
+			if g.typ(e) != first {
+				return "[]any"
+			}
+		}
+		return fmt.Sprintf("[%d]%s", len(t.Elements), first)
+	case signature.KindObject:
+		fields := g.fields(t)
+		if len(fields) == 0 {
+			return "struct{}"
+		}
+		return "struct { " + strings.Join(fields, "; ") + " }"
+	case signature.KindMap:
+		key := "string"
+		if t.KeyType != nil && t.KeyType.Primitive == signature.PrimitiveInt {
+			key = "int"
+		}
+		return "map[" + key + "]" + g.typ(t.ValueType)
+	case signature.KindUnion:
+		// Only a single type or null can be expressed, as a pointer
+		var alternatives []*signature.TypeDef
+		for _, alt := range t.Types {
+			if alt == nil || alt.Kind != signature.KindPrimitive || alt.Primitive != signature.PrimitiveNull {
+				alternatives = append(alternatives, alt)
+			}
+		}
+		if len(alternatives) == 1 {
+			return nullable(g.typ(alternatives[0]))
+		}
+	case signature.KindReference:
+		// Named structs are referenced through pointers, so they can be recursive and null
+		if nt := g.schema.NamedType(t.Name); nt != nil && nt.Definition != nil && nt.Definition.Kind == signature.KindObject {
+			return "*" + t.Name
+		}
+		return t.Name
+	}
+	return "any"
+}
+
+// fields renders the properties of an object type as struct fields with JSON tags
+func (g goTypes) fields(t *signature.TypeDef) []string {
+	keys := sortedKeys(t.Properties)
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		fields[i] = fmt.Sprintf("%s %s `json:%q`", exportedName(key), g.typ(t.Properties[key]), key)
+	}
+	return fields
+}
+
+// nullable makes a type able to hold null, unless it already can
+func nullable(typ string) string {
+	for _, prefix := range []string{"*", "[]", "map[", "any"} {
+		if strings.HasPrefix(typ, prefix) {
+			return typ
+		}
+	}
+	return "*" + typ
+}
+
+// exportedName turns a JSON key such as "node_id" into an exported field name like NodeID
+func exportedName(key string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	name := b.String()
+	if strings.HasSuffix(name, "Id") {
+		name = strings.TrimSuffix(name, "Id") + "ID"
+	}
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "F" + name
+	}
+	return name
+}
@@ -0,0 +1,263 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+)
+
+// javaScriptHarness imports the solution module, calls the function with the positional
+// arguments read from stdin and prints the JSON-encoded return value. Sets and maps are
+// encoded as arrays and objects, and promises are awaited.
+const javaScriptHarness = `import * as solution from "./{{.SolutionFile}}";
+
+const functionName = {{json .FunctionName}};
+
+function encode(key, value) {
+  if (value instanceof Set) return [...value];
+  if (value instanceof Map) return Object.fromEntries(value);
+  if (typeof value === "bigint") return Number(value);
+  return value;
+}
+
+const chunks = [];
+for await (const chunk of process.stdin) chunks.push(chunk);
+const args = JSON.parse(Buffer.concat(chunks).toString("utf8"));
+
+const fn = solution[functionName];
+if (typeof fn !== "function") {
+  console.error(` + "`solution does not define a function named ${functionName}`" + `);
+  process.exit(1);
+}
+const result = await fn(...args);
+process.stdout.write("\n{{.ResultMarker}}" + JSON.stringify(result === undefined ? null : result, encode) + "\n");
+`
+
+// newJavaScriptRunner creates the runner for JavaScript or TypeScript. Both run on Node as
+// ES modules; TypeScript relies on Node's type stripping, available from Node 22.6.
+func newJavaScriptRunner(language string) *Runner {
+	r := &Runner{
+		Language:     JavaScript,
+		Name:         "JavaScript",
+		SolutionFile: "solution.js",
+		HarnessFile:  "harness.js",
+		Interpreter:  []string{"node"},
+		files:        map[string]string{"package.json": `{"type": "module"}` + "\n"},
+		prepare:      prepareJavaScript,
+		starter:      javaScriptStarter,
+	}
+	if language == TypeScript {
+		r.Language = TypeScript
+		r.Name = "TypeScript"
+		r.SolutionFile = "solution.ts"
+		r.Interpreter = []string{"node", "--experimental-strip-types", "--no-warnings"}
+		r.starter = typeScriptStarter
+	}
+	r.harness = harnessTemplate(r.Language, javaScriptHarness)
+	return r
+}
+
+// typeScriptNode is the first Node release that strips TypeScript types
+var typeScriptNode = [3]int{22, 6, 0}
+
+// checkTypeScriptNode checks the output of `node --version` for TypeScript support
+func checkTypeScriptNode(output []byte, err error) error {
+	if err != nil {
+		return fmt.Errorf("%w: TypeScript needs Node %d.%d or later, which could not be run: %v",
+			ErrUnsupportedRuntime, typeScriptNode[0], typeScriptNode[1], err)
+	}
+	version := strings.TrimSpace(string(output))
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	var got [3]int
+	for i := range got {
+		if i >= len(parts) {
+			break
+		}
+		n, convErr := strconv.Atoi(parts[i])
+		if convErr != nil {
+			return fmt.Errorf("%w: cannot read Node version %q", ErrUnsupportedRuntime, version)
+		}
+		got[i] = n
+	}
+	if slices.Compare(got[:], typeScriptNode[:]) < 0 {
+		return fmt.Errorf("%w: TypeScript needs Node %d.%d or later, found %s",
+			ErrUnsupportedRuntime, typeScriptNode[0], typeScriptNode[1], version)
+	}
+	return nil
+}
+
+// prepareJavaScript exports the function if the solution does not, so the harness can
+// import it
+func prepareJavaScript(code string, schema *signature.FunctionSignatureSchema) string {
+	name := regexp.QuoteMeta(schema.FunctionName)
+	exported := regexp.MustCompile(
+		`\bexport\s+(default\s+)?(async\s+)?function\s*\*?\s*` + name + `\b` +
+			`|\bexport\s+(const|let|var)\s+` + name + `\b` +
+			`|\bexport\s*\{[^}]*\b` + name + `\b[^}]*\}`)
+	if exported.MatchString(code) {
+		return code + "\n"
+	}
+	return fmt.Sprintf("%s\n\nexport { %s };\n", code, schema.FunctionName)
+}
+
+var javaScriptReserved = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true, "continue": true,
+	"debugger": true, "default": true, "delete": true, "do": true, "else": true, "enum": true,
+	"export": true, "extends": true, "false": true, "finally": true, "for": true,
+	"function": true, "if": true, "import": true, "in": true, "instanceof": true, "new": true,
+	"null": true, "return": true, "super": true, "switch": true, "this": true, "throw": true,
+	"true": true, "try": true, "typeof": true, "var": true, "void": true, "while": true,
+	"with": true, "yield": true, "let": true, "static": true, "await": true,
+}
+
+func javaScriptParamName(name string) string {
+	if javaScriptReserved[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// typeScriptStarter declares named types as interfaces or type aliases, and the function
+// with typed parameters
+func typeScriptStarter(schema *signature.FunctionSignatureSchema) string {
+	var b strings.Builder
+	for _, nt := range schema.NamedTypes {
+		if nt.Description != "" {
+			fmt.Fprintf(&b, "/** %s */\n", nt.Description)
+		}
+		if nt.Definition != nil && nt.Definition.Kind == signature.KindObject {
+			fmt.Fprintf(&b, "interface %s {\n", nt.Name)
+			for _, field := range typeScriptFields(nt.Definition) {
+				fmt.Fprintf(&b, "  %s;\n", field)
+			}
+			b.WriteString("}\n\n")
+		} else {
+			fmt.Fprintf(&b, "type %s = %s;\n\n", nt.Name, typeScriptType(nt.Definition))
+		}
+	}
+
+	if docs := paramDocs(schema); len(docs) > 0 {
+		b.WriteString("/**\n")
+		for _, doc := range docs {
+			fmt.Fprintf(&b, " * @param %s %s\n", javaScriptParamName(doc[0]), doc[1])
+		}
+		b.WriteString(" */\n")
+	}
+	params := make([]string, len(schema.Parameters))
+	for i, p := range schema.Parameters {
+		optional := ""
+		if p.Optional {
+			optional = "?"
+		}
+		params[i] = fmt.Sprintf("%s%s: %s", javaScriptParamName(p.Name), optional, typeScriptType(p.Type))
+	}
+	fmt.Fprintf(&b, "export function %s(%s): %s {\n", schema.FunctionName, strings.Join(params, ", "), typeScriptType(schema.ReturnType))
+	b.WriteString("  throw new Error(\"Not implemented\");\n}\n")
+	return b.String()
+}
+
+// javaScriptStarter declares the function with its types in a JSDoc comment
+func javaScriptStarter(schema *signature.FunctionSignatureSchema) string {
+	var b strings.Builder
+	for _, nt := range schema.NamedTypes {
+		fmt.Fprintf(&b, "/**\n")
+		if nt.Description != "" {
+			fmt.Fprintf(&b, " * %s\n", nt.Description)
+		}
+		fmt.Fprintf(&b, " * @typedef {%s} %s\n */\n\n", typeScriptType(nt.Definition), nt.Name)
+	}
+
+	b.WriteString("/**\n")
+	params := make([]string, len(schema.Parameters))
+	for i, p := range schema.Parameters {
+		name := javaScriptParamName(p.Name)
+		params[i] = name
+		if p.Optional {
+			name = "[" + name + "]"
+		}
+		line := fmt.Sprintf(" * @param {%s} %s", typeScriptType(p.Type), name)
+		if p.Description != "" {
+			line += " " + p.Description
+		}
+		b.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&b, " * @returns {%s}\n */\n", typeScriptType(schema.ReturnType))
+	fmt.Fprintf(&b, "export function %s(%s) {\n", schema.FunctionName, strings.Join(params, ", "))
+	b.WriteString("  throw new Error(\"Not implemented\");\n}\n")
+	return b.String()
+}
+
+// typeScriptType renders a TypeScript type
+func typeScriptType(t *signature.TypeDef) string {
+	if t == nil {
+		return "unknown"
+	}
+	switch t.Kind {
+	case signature.KindPrimitive:
+		switch t.Primitive {
+		case signature.PrimitiveInt, signature.PrimitiveFloat:
+			return "number"
+		case signature.PrimitiveString:
+			return "string"
+		case signature.PrimitiveBoolean:
+			return "boolean"
+		case signature.PrimitiveNull:
+			return "null"
+		}
+	case signature.KindArray:
+		items := typeScriptType(t.Items)
+		if t.Items != nil && t.Items.Kind == signature.KindUnion {
+			items = "(" + items + ")"
+		}
+		return items + "[]"
+	case signature.KindTuple:
+		elements := make([]string, len(t.Elements))
+		for i, e := range t.Elements {
+			elements[i] = typeScriptType(e)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case signature.KindObject:
+		return typeScriptObject(t)
+	case signature.KindMap:
+		key := "string"
+		if t.KeyType != nil && t.KeyType.Primitive == signature.PrimitiveInt {
+			key = "number"
+		}
+		return "Record<" + key + ", " + typeScriptType(t.ValueType) + ">"
+	case signature.KindUnion:
+		alternatives := make([]string, len(t.Types))
+		for i, alt := range t.Types {
+			alternatives[i] = typeScriptType(alt)
+		}
+		return strings.Join(alternatives, " | ")
+	case signature.KindReference:
+		return t.Name
+	}
+	return "unknown"
+}
+
+func typeScriptObject(t *signature.TypeDef) string {
+	fields := typeScriptFields(t)
+	if len(fields) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(fields, "; ") + " }"
+}
+
+// typeScriptFields renders the properties of an object type as "name: type"
+func typeScriptFields(t *signature.TypeDef) []string {
+	keys := sortedKeys(t.Properties)
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		name := key
+		if !identifierPattern.MatchString(key) {
+			name = fmt.Sprintf("%q", key)
+		}
+		fields[i] = fmt.Sprintf("%s: %s", name, typeScriptType(t.Properties[key]))
+	}
+	return fields
+}
@@ -0,0 +1,223 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+)
+
+// pythonHarness loads solution.py, calls the function with the positional arguments read
+// from stdin and prints the JSON-encoded return value
+const pythonHarness = `import json
+import sys
+
+
+def _encode(value):
+    if isinstance(value, (set, frozenset, tuple)):
+        return list(value)
+    if hasattr(value, "__dict__"):
+        return value.__dict__
+    raise TypeError(f"Object of type {type(value).__name__} is not JSON serializable")
+
+
+def main():
+    function_name = {{json .FunctionName}}
+    args = json.load(sys.stdin)
+    namespace = {"__name__": "solution"}
+    with open("solution.py") as f:
+        exec(compile(f.read(), "solution.py", "exec"), namespace)
+    fn = namespace.get(function_name)
+    if not callable(fn):
+        raise SystemExit(f"solution does not define a function named {function_name}")
+    result = fn(*args)
+    sys.stdout.write("\n{{.ResultMarker}}" + json.dumps(result, default=_encode) + "\n")
+
+
+main()
+`
+
+func newPythonRunner() *Runner {
+	return &Runner{
+		Language:     Python,
+		Name:         "Python",
+		SolutionFile: "solution.py",
+		HarnessFile:  "harness.py",
+		Interpreter:  []string{"python3", "-I"},
+		harness:      harnessTemplate("python", pythonHarness),
+		starter:      pythonStarter,
+	}
+}
+
+var pythonKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true,
+	"async": true, "await": true, "break": true, "class": true, "continue": true, "def": true,
+	"del": true, "elif": true, "else": true, "except": true, "finally": true, "for": true,
+	"from": true, "global": true, "if": true, "import": true, "in": true, "is": true,
+	"lambda": true, "nonlocal": true, "not": true, "or": true, "pass": true, "raise": true,
+	"return": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// pythonStarter declares named types as TypedDicts or type aliases, and the function with
+// type hints and a docstring listing parameter descriptions
+func pythonStarter(schema *signature.FunctionSignatureSchema) string {
+	imports := map[string]bool{}
+	var b strings.Builder
+
+	var decls strings.Builder
+	for _, nt := range schema.NamedTypes {
+		if nt.Definition != nil && nt.Definition.Kind == signature.KindObject {
+			imports["TypedDict"] = true
+			decls.WriteString(pythonTypedDict(nt, imports))
+		} else {
+			imports["TypeAlias"] = true
+			fmt.Fprintf(&decls, "%s: TypeAlias = %q\n", nt.Name, pythonType(nt.Definition, imports))
+		}
+		decls.WriteString("\n\n")
+	}
+
+	params := make([]string, len(schema.Parameters))
+	for i, p := range schema.Parameters {
+		name := p.Name
+		if pythonKeywords[name] {
+			name += "_"
+		}
+		if p.Optional {
+			params[i] = fmt.Sprintf("%s: %s | None = None", name, pythonType(p.Type, imports))
+		} else {
+			params[i] = fmt.Sprintf("%s: %s", name, pythonType(p.Type, imports))
+		}
+	}
+	returnType := pythonType(schema.ReturnType, imports)
+
+	b.WriteString("from __future__ import annotations\n\n")
+	if len(imports) > 0 {
+		names := make([]string, 0, len(imports))
+		for name := range imports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&b, "from typing import %s\n\n", strings.Join(names, ", "))
+	}
+	b.WriteString("\n")
+	b.WriteString(decls.String())
+
+	fmt.Fprintf(&b, "def %s(%s) -> %s:\n", schema.FunctionName, strings.Join(params, ", "), returnType)
+	if docs := paramDocs(schema); len(docs) > 0 {
+		b.WriteString("    \"\"\"\n    Args:\n")
+		for _, doc := range docs {
+			fmt.Fprintf(&b, "        %s: %s\n", doc[0], doc[1])
+		}
+		b.WriteString("    \"\"\"\n")
+	}
+	b.WriteString("    raise NotImplementedError\n")
+	return b.String()
+}
+
+// pythonTypedDict declares an object type as a TypedDict, with the functional syntax if
+// its keys are not all identifiers
+func pythonTypedDict(nt signature.NamedType, imports map[string]bool) string {
+	keys := sortedKeys(nt.Definition.Properties)
+	classSyntax := true
+	for _, key := range keys {
+		if !identifierPattern.MatchString(key) || pythonKeywords[key] {
+			classSyntax = false
+		}
+	}
+
+	var b strings.Builder
+	if !classSyntax {
+		fields := make([]string, len(keys))
+		for i, key := range keys {
+			fields[i] = fmt.Sprintf("%q: %s", key, pythonType(nt.Definition.Properties[key], imports))
+		}
+		fmt.Fprintf(&b, "%s = TypedDict(%q, {%s})\n", nt.Name, nt.Name, strings.Join(fields, ", "))
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "class %s(TypedDict):\n", nt.Name)
+	if nt.Description != "" {
+		fmt.Fprintf(&b, "    \"\"\"%s\"\"\"\n\n", nt.Description)
+	}
+	for _, key := range keys {
+		fmt.Fprintf(&b, "    %s: %s\n", key, pythonType(nt.Definition.Properties[key], imports))
+	}
+	if len(keys) == 0 {
+		b.WriteString("    pass\n")
+	}
+	return b.String()
+}
+
+// pythonType renders a type hint, recording the typing names it needs in imports
+func pythonType(t *signature.TypeDef, imports map[string]bool) string {
+	if t == nil {
+		imports["Any"] = true
+		return "Any"
+	}
+	switch t.Kind {
+	case signature.KindPrimitive:
+		switch t.Primitive {
+		case signature.PrimitiveInt:
+			return "int"
+		case signature.PrimitiveFloat:
+			return "float"
+		case signature.PrimitiveString:
+			return "str"
+		case signature.PrimitiveBoolean:
+			return "bool"
+		case signature.PrimitiveNull:
+			return "None"
+		}
+	case signature.KindArray:
+		return "list[" + pythonType(t.Items, imports) + "]"
+	case signature.KindTuple:
+		elements := make([]string, len(t.Elements))
+		for i, e := range t.Elements {
+			elements[i] = pythonType(e, imports)
+		}
+		return "tuple[" + strings.Join(elements, ", ") + "]"
+	case signature.KindObject:
+		imports["Any"] = true
+		return "dict[str, Any]"
+	case signature.KindMap:
+		key := "str"
+		if t.KeyType != nil && t.KeyType.Primitive == signature.PrimitiveInt {
+			key = "int"
+		}
+		return "dict[" + key + ", " + pythonType(t.ValueType, imports) + "]"
+	case signature.KindUnion:
+		alternatives := make([]string, len(t.Types))
+		for i, alt := range t.Types {
+			alternatives[i] = pythonType(alt, imports)
+		}
+		return strings.Join(alternatives, " | ")
+	case signature.KindReference:
+		return t.Name
+	}
+	imports["Any"] = true
+	return "Any"
+}
+
+// paramDocs returns the name and description of each described parameter
+func paramDocs(schema *signature.FunctionSignatureSchema) [][2]string {
+	var docs [][2]string
+	for _, p := range schema.Parameters {
+		if p.Description != "" {
+			docs = append(docs, [2]string{p.Name, p.Description})
+		}
+	}
+	return docs
+}
+
+func sortedKeys(m map[string]*signature.TypeDef) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,201 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+)
+
+// Supported languages
+const (
+	Python     = "python"
+	JavaScript = "javascript"
+	TypeScript = "typescript"
+	Go         = "go"
+)
+
+// ErrUnsupportedLanguage is returned for a language no runner handles
+var ErrUnsupportedLanguage = errors.New("unsupported language")
+
+// ErrUnsupportedRuntime is returned for a language whose toolchain on the server is missing
+// or too old to run it
+var ErrUnsupportedRuntime = errors.New("unsupported runtime")
+
+// ResultMarker prefixes the line on which a harness prints the function's return value,
+// separating it from anything the solution itself prints
+const ResultMarker = "__CLANKERLOOP_RESULT__"
+
+// Config holds settings for the runners
+type Config struct {
+	// GoCacheDir is the build cache shared by Go builds. Only the compiler writes to it;
+	// the programs it builds run without it.
+	GoCacheDir string
+}
+
+// Runner runs solutions written in one language. A harness program reads the function's
+// positional arguments as a JSON array on stdin, calls the solution's function and prints
+// ResultMarker followed by the JSON-encoded return value.
+type Runner struct {
+	// Language is the identifier used in requests
+	Language string
+	// Name is the language's display name, as used in prompts
+	Name string
+	// SolutionFile is the file the prepared solution is written to
+	SolutionFile string
+	// HarnessFile is the file the harness is written to
+	HarnessFile string
+	// Interpreter runs a source file; it is nil for compiled languages
+	Interpreter []string
+	// Build compiles the files into Program; it is nil for interpreted languages
+	Build []string
+	// BuildEnv holds extra environment variables for Build
+	BuildEnv []string
+	// BuildTimeout is the wall-clock limit for Build
+	BuildTimeout time.Duration
+	// Program is the executable Build produces
+	Program string
+
+	// files are written next to the solution and harness
+	files   map[string]string
+	harness *template.Template
+	// prepare adapts a solution to the harness, e.g. by exporting its function
+	prepare func(code string, schema *signature.FunctionSignatureSchema) string
+	// starter generates stub code for a function signature
+	starter func(schema *signature.FunctionSignatureSchema) string
+	// unavailable says why the server cannot run programs in the language, if it cannot
+	unavailable error
+}
+
+// Compiled reports whether solutions have to be built before they run
+func (r *Runner) Compiled() bool {
+	return len(r.Build) > 0
+}
+
+// Files returns the files that make up the program running code: the prepared solution,
+// the harness for the schema's function and any support files
+func (r *Runner) Files(code string, schema *signature.FunctionSignatureSchema) (map[string]string, error) {
+	var harness bytes.Buffer
+	err := r.harness.Execute(&harness, map[string]string{
+		"FunctionName": schema.FunctionName,
+		"SolutionFile": r.SolutionFile,
+		"ResultMarker": ResultMarker,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s harness: %w", r.Name, err)
+	}
+
+	files := map[string]string{
+		r.SolutionFile: r.PrepareCode(code, schema),
+		r.HarnessFile:  harness.String(),
+	}
+	for name, content := range r.files {
+		files[name] = content
+	}
+	return files, nil
+}
+
+// Command returns the command that runs the harness, after Build for compiled languages
+func (r *Runner) Command() []string {
+	if r.Compiled() {
+		return []string{"./" + r.Program}
+	}
+	return r.ScriptCommand(r.HarnessFile)
+}
+
+// ScriptCommand returns the command that runs a source file of an interpreted language
+func (r *Runner) ScriptCommand(file string) []string {
+	return append(append([]string{}, r.Interpreter...), file)
+}
+
+// PrepareCode applies the language's preparation hook to code
+func (r *Runner) PrepareCode(code string, schema *signature.FunctionSignatureSchema) string {
+	code = strings.TrimSpace(code)
+	if r.prepare == nil {
+		return code + "\n"
+	}
+	return r.prepare(code, schema)
+}
+
+// StarterCode generates a stub of the schema's function, with types for its parameters,
+// return value and named types
+func (r *Runner) StarterCode(schema *signature.FunctionSignatureSchema) string {
+	return r.starter(schema)
+}
+
+// Registry holds the runner of each supported language
+type Registry struct {
+	runners map[string]*Runner
+	// languages lists the languages in a fixed order
+	languages []string
+}
+
+// NewRegistry creates the runners for all supported languages
+func NewRegistry(cfg Config) *Registry {
+	reg := &Registry{runners: map[string]*Runner{}}
+	for _, r := range []*Runner{
+		newPythonRunner(),
+		newJavaScriptRunner(JavaScript),
+		newJavaScriptRunner(TypeScript),
+		newGoRunner(cfg.GoCacheDir),
+	} {
+		reg.runners[r.Language] = r
+		reg.languages = append(reg.languages, r.Language)
+	}
+	reg.runners[TypeScript].unavailable = checkTypeScriptNode(exec.Command(lookPath("node"), "--version").Output())
+	return reg
+}
+
+// Get returns the runner for a language, which may only be used for starter code if the
+// server cannot run the language (see Runnable)
+func (reg *Registry) Get(language string) (*Runner, error) {
+	r, ok := reg.runners[language]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q (supported: %s)", ErrUnsupportedLanguage, language, strings.Join(reg.languages, ", "))
+	}
+	return r, nil
+}
+
+// Runnable returns the runner for a language, or ErrUnsupportedRuntime if the server's
+// toolchain cannot run it
+func (reg *Registry) Runnable(language string) (*Runner, error) {
+	r, err := reg.Get(language)
+	if err != nil {
+		return nil, err
+	}
+	if r.unavailable != nil {
+		return nil, r.unavailable
+	}
+	return r, nil
+}
+
+// Languages lists the supported languages
+func (reg *Registry) Languages() []string {
+	return append([]string{}, reg.languages...)
+}
+
+// harnessTemplate parses a harness. Templates get FunctionName, SolutionFile and
+// ResultMarker, and json for quoting values as string literals.
+func harnessTemplate(name, text string) *template.Template {
+	return template.Must(template.New(name).Funcs(template.FuncMap{
+		"json": func(v string) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(text))
+}
+
+// lookPath resolves a tool on the server's PATH, which programs do not share, falling back
+// to the bare name
+func lookPath(name string) string {
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+	return name
+}
@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/executor"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+)
+
+func TestCheckTypeScriptNode(t *testing.T) {
+	tests := []struct {
+		output string
+		err    error
+		// wantErr is a substring of the expected error, or empty if TypeScript is supported
+		wantErr string
+	}{
+		{"v22.6.0\n", nil, ""},
+		{"v22.12.1\n", nil, ""},
+		{"v23.0.0\n", nil, ""},
+		{"v22.5.1\n", nil, "TypeScript needs Node 22.6 or later, found v22.5.1"},
+		{"v20.19.5\n", nil, "found v20.19.5"},
+		{"v22\n", nil, "found v22"},
+		{"nightly\n", nil, `cannot read Node version "nightly"`},
+		{"", exec.ErrNotFound, "could not be run"},
+	}
+	for _, tt := range tests {
+		err := checkTypeScriptNode([]byte(tt.output), tt.err)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkTypeScriptNode(%q) = %v, want nil", tt.output, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrUnsupportedRuntime) || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("checkTypeScriptNode(%q) = %v, want unsupported runtime error containing %q", tt.output, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRegistryRunnable(t *testing.T) {
+	reg := NewRegistry(Config{})
+	reg.runners[TypeScript].unavailable = checkTypeScriptNode([]byte("v20.0.0"), nil)
+
+	// Starter code can still be generated for a language the server cannot run
+	if _, err := reg.Get(TypeScript); err != nil {
+		t.Errorf("Get(%q) = %v, want nil", TypeScript, err)
+	}
+	if _, err := reg.Runnable(TypeScript); !errors.Is(err, ErrUnsupportedRuntime) {
+		t.Errorf("Runnable(%q) = %v, want %v", TypeScript, err, ErrUnsupportedRuntime)
+	}
+	if _, err := reg.Runnable(Python); err != nil {
+		t.Errorf("Runnable(%q) = %v, want nil", Python, err)
+	}
+	if _, err := reg.Runnable("cobol"); !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("Runnable(%q) = %v, want %v", "cobol", err, ErrUnsupportedLanguage)
+	}
+}
+
+func TestPrepareJavaScript(t *testing.T) {
+	schema := &signature.FunctionSignatureSchema{FunctionName: "twoSum"}
+	tests := []struct {
+		name       string
+		code       string
+		wantExport bool
+	}{
+		{"plain function", "function twoSum(a, b) {}", true},
+		{"arrow function", "const twoSum = (a, b) => {};", true},
+		{"exported function", "export function twoSum(a, b) {}", false},
+		{"exported async function", "export async function twoSum(a, b) {}", false},
+		{"exported const", "export const twoSum = (a, b) => {};", false},
+		{"export list", "function twoSum(a, b) {}\nexport { helper, twoSum };", false},
+		{"other function exported", "export function twoSumHelper() {}\nfunction twoSum() {}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := prepareJavaScript(tt.code, schema)
+			if exported := strings.HasSuffix(got, "export { twoSum };\n"); exported != tt.wantExport {
+				t.Errorf("prepareJavaScript(%q) = %q, want export added: %v", tt.code, got, tt.wantExport)
+			}
+		})
+	}
+}
+
+func TestPrepareGo(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"no package clause", "func f() {}", "package main\n\nfunc f() {}\n"},
+		{"other package", "package solution\n\nfunc f() {}", "package main\n\nfunc f() {}\n"},
+		{"package main", "package main\n\nfunc f() {}", "package main\n\nfunc f() {}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prepareGo(tt.code, nil); got != tt.want {
+				t.Errorf("prepareGo() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// The harnesses pass the JSON array on stdin as positional arguments and print the return
+// value after the result marker
+func TestHarnessBindsArguments(t *testing.T) {
+	schema := &signature.FunctionSignatureSchema{FunctionName: "describe"}
+	tests := []struct {
+		language string
+		code     string
+	}{
+		{Python, "def describe(nums, label, flag):\n    return {\"sum\": sum(nums), \"label\": label, \"flag\": flag}"},
+		{JavaScript, "function describe(nums, label, flag) {\n  return { sum: nums.reduce((a, b) => a + b, 0), label, flag };\n}"},
+	}
+
+	reg := NewRegistry(Config{})
+	e := executor.New(executor.Limits{Timeout: 10 * time.Second})
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			r, err := reg.Runnable(tt.language)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := exec.LookPath(r.Interpreter[0]); err != nil {
+				t.Skipf("%s is not installed", r.Interpreter[0])
+			}
+			files, err := r.Files(tt.code, schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := e.Run(context.Background(), executor.Request{
+				Command: r.Command(),
+				Files:   files,
+				Stdin:   []byte(`[[1, 2, 3], "abc", true]`),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if failure := result.Failure(); failure != "" {
+				t.Fatalf("harness %s: %s", failure, result.Stderr)
+			}
+			_, output, found := strings.Cut(result.Stdout, ResultMarker)
+			if !found {
+				t.Fatalf("stdout %q has no result marker", result.Stdout)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal([]byte(output), &got); err != nil {
+				t.Fatalf("result %q is not JSON: %v", output, err)
+			}
+			want := map[string]interface{}{"sum": 6.0, "label": "abc", "flag": true}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("result = %v, want %v", got, want)
+			}
+		})
+	}
+}
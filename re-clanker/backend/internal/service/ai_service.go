@@ -4,189 +4,824 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
 )
 
 // AIProvider defines the interface for AI services
 type AIProvider interface {
-	GenerateCompletion(ctx context.Context, prompt string, model string) (string, error)
+	// GenerateCompletion completes a conversation
+	GenerateCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error)
+	// StreamCompletion completes a conversation like GenerateCompletion, passing each text
+	// delta to onDelta as it arrives. An error from onDelta aborts the stream.
+	StreamCompletion(ctx context.Context, req *CompletionRequest, onDelta func(delta string) error) (*CompletionResponse, error)
 }
 
-// OpenRouterProvider implements AIProvider for OpenRouter
-type OpenRouterProvider struct {
-	apiKey     string
-	httpClient *http.Client
+// ResponseSchema is a JSON schema that a structured completion must conform to
+type ResponseSchema struct {
+	// Name identifies the schema to the provider (letters, digits, underscores)
+	Name   string
+	Schema map[string]interface{}
 }
 
-// NewOpenRouterProvider creates a new OpenRouter provider
-func NewOpenRouterProvider(apiKey string) *OpenRouterProvider {
-	return &OpenRouterProvider{
-		apiKey:     apiKey,
-		httpClient: &http.Client{},
-	}
+// ErrStructuredOutputUnsupported is returned when a provider cannot enforce a schema natively
+var ErrStructuredOutputUnsupported = errors.New("structured output is not supported for this schema")
+
+// newHTTPClients returns a client for blocking requests, bounded by timeout as a whole, and
+// one for streaming requests, where timeout only bounds the wait for response headers
+func newHTTPClients(timeout time.Duration) (*http.Client, *http.Client) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{Timeout: timeout}, &http.Client{Transport: transport}
 }
 
-// GenerateCompletion generates text using OpenRouter
-func (p *OpenRouterProvider) GenerateCompletion(ctx context.Context, prompt string, model string) (string, error) {
-	if model == "" {
-		model = "anthropic/claude-3.5-sonnet" // Default model for OpenRouter
-	}
+// Provider names, as used for AI_PROVIDER and in errors
+const (
+	ProviderOpenRouter       = "openrouter"
+	ProviderGemini           = "gemini"
+	ProviderOpenAICompatible = "openai-compatible"
+)
 
-	requestBody := map[string]interface{}{
-		"model": model,
-		"messages": []map[string]string{
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
+// ProviderNames lists every provider that can be configured
+var ProviderNames = []string{ProviderOpenRouter, ProviderGemini, ProviderOpenAICompatible, ProviderReplay}
+
+// OpenAICompatibleConfig configures a server that implements the OpenAI chat completions API
+type OpenAICompatibleConfig struct {
+	// BaseURL is the API root that /chat/completions is appended to,
+	// e.g. http://localhost:8000/v1
+	BaseURL string
+	// APIKey is sent as a bearer token if set
+	APIKey string
+	// Headers are added to every request
+	Headers map[string]string
+	// DefaultModel is used when a request names no model. If it is empty too, the model is
+	// left out and the server picks one.
+	DefaultModel string
+}
+
+// OpenAICompatibleProvider implements AIProvider for the OpenAI chat completions API, as
+// served by OpenRouter, vLLM, llama.cpp and others
+type OpenAICompatibleProvider struct {
+	name         string
+	config       OpenAICompatibleConfig
+	extraBody    map[string]interface{}
+	httpClient   *http.Client
+	streamClient *http.Client
+}
+
+// NewOpenAICompatibleProvider creates a provider for an OpenAI-compatible server. name
+// identifies the provider in errors and usage records.
+func NewOpenAICompatibleProvider(name string, config OpenAICompatibleConfig, timeout time.Duration) *OpenAICompatibleProvider {
+	httpClient, streamClient := newHTTPClients(timeout)
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	return &OpenAICompatibleProvider{
+		name:         name,
+		config:       config,
+		httpClient:   httpClient,
+		streamClient: streamClient,
 	}
+}
 
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+// NewOpenRouterProvider creates a new OpenRouter provider. An empty baseURL uses OpenRouter's API.
+func NewOpenRouterProvider(apiKey, baseURL string, timeout time.Duration) *OpenAICompatibleProvider {
+	if baseURL == "" {
+		baseURL = "https://openrouter.ai/api/v1"
 	}
+	p := NewOpenAICompatibleProvider(ProviderOpenRouter, OpenAICompatibleConfig{
+		BaseURL:      baseURL,
+		APIKey:       apiKey,
+		Headers:      map[string]string{"HTTP-Referer": "https://github.com/boobachad/clankerloop"},
+		DefaultModel: "anthropic/claude-3.5-sonnet", // Default model for OpenRouter
+	}, timeout)
+	// Ask OpenRouter to report token counts and cost
+	p.extraBody = map[string]interface{}{"usage": map[string]bool{"include": true}}
+	return p
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://openrouter.ai/api/v1/chat/completions", bytes.NewBuffer(jsonData))
+// GenerateCompletion generates text using the chat completions endpoint
+func (p *OpenAICompatibleProvider) GenerateCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	requestBody, err := p.requestBody(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("HTTP-Referer", "https://github.com/boobachad/clankerloop")
-
-	resp, err := p.httpClient.Do(req)
+	resp, err := p.send(ctx, p.httpClient, requestBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("OpenRouter API error (status %d): %s", resp.StatusCode, string(body))
-	}
-
 	var response struct {
+		Model   string `json:"model"`
 		Choices []struct {
 			Message struct {
 				Content string `json:"content"`
 			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	if len(response.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenRouter")
+		return nil, fmt.Errorf("no response from %s", p.name)
+	}
+	if response.Choices[0].FinishReason == "content_filter" {
+		return nil, newContentFilterError(p.name, response.Choices[0].FinishReason)
+	}
+
+	return &CompletionResponse{
+		Text:         response.Choices[0].Message.Content,
+		FinishReason: response.Choices[0].FinishReason,
+		Provider:     p.name,
+		Model:        firstNonEmpty(response.Model, requestModel(requestBody)),
+		Usage:        response.Usage.toUsage(),
+	}, nil
+}
+
+// StreamCompletion streams text from the chat completions endpoint's server-sent events
+func (p *OpenAICompatibleProvider) StreamCompletion(ctx context.Context, req *CompletionRequest, onDelta func(delta string) error) (*CompletionResponse, error) {
+	requestBody, err := p.requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	requestBody["stream"] = true
+	requestBody["stream_options"] = map[string]bool{"include_usage": true}
+
+	resp, err := p.send(ctx, p.streamClient, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	result := &CompletionResponse{Provider: p.name, Model: requestModel(requestBody)}
+	err = readSSE(resp.Body, func(data string) error {
+		if data == "[DONE]" {
+			return errStreamDone
+		}
+		var chunk struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Error *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+			Usage *openAIUsage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			kind := ErrorKindServer
+			if chunk.Error.Code == http.StatusTooManyRequests {
+				kind = ErrorKindRateLimit
+			}
+			return &ProviderError{Provider: p.name, Kind: kind, StatusCode: chunk.Error.Code, Message: chunk.Error.Message}
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		// Usage arrives in the final chunk, which has no choices
+		if chunk.Usage != nil {
+			result.Usage = chunk.Usage.toUsage()
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		if reason := chunk.Choices[0].FinishReason; reason != nil {
+			if *reason == "content_filter" {
+				return newContentFilterError(p.name, *reason)
+			}
+			result.FinishReason = *reason
+		}
+		delta := chunk.Choices[0].Delta.Content
+		if delta == "" {
+			return nil
+		}
+		text.WriteString(delta)
+		return onDelta(delta)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Text = text.String()
+	return result, nil
+}
+
+// requestBody maps a completion request to a chat completion body
+func (p *OpenAICompatibleProvider) requestBody(req *CompletionRequest) (map[string]interface{}, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	messages := make([]map[string]string, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		messages = append(messages, map[string]string{
+			"role":    string(m.Role),
+			"content": m.Content,
+		})
+	}
+
+	requestBody := map[string]interface{}{
+		"messages": messages,
+	}
+	for key, value := range p.extraBody {
+		requestBody[key] = value
+	}
+	if model := firstNonEmpty(req.Model, p.config.DefaultModel); model != "" {
+		requestBody["model"] = model
 	}
+	if req.Params.Temperature != nil {
+		requestBody["temperature"] = *req.Params.Temperature
+	}
+	if req.Params.MaxTokens != nil {
+		requestBody["max_tokens"] = *req.Params.MaxTokens
+	}
+	if len(req.Params.Stop) > 0 {
+		requestBody["stop"] = req.Params.Stop
+	}
+	if req.Params.Seed != nil {
+		requestBody["seed"] = *req.Params.Seed
+	}
+	if req.ResponseSchema != nil {
+		requestBody["response_format"] = map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name": req.ResponseSchema.Name,
+				// Strict mode rejects open-ended maps such as object properties, so the
+				// schema is advisory and the result is validated by the caller
+				"strict": false,
+				"schema": req.ResponseSchema.Schema,
+			},
+		}
+	}
+	return requestBody, nil
+}
+
+// requestModel returns the model named in a chat completion body, if any
+func requestModel(requestBody map[string]interface{}) string {
+	model, _ := requestBody["model"].(string)
+	return model
+}
 
-	return response.Choices[0].Message.Content, nil
+// openAIUsage is the usage block of a chat completion response. Cost is only reported by
+// OpenRouter.
+type openAIUsage struct {
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	Cost             *float64 `json:"cost"`
+}
+
+func (u *openAIUsage) toUsage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens, CostUSD: u.Cost}
+}
+
+// send posts a chat completion request and returns the response if it succeeded
+func (p *OpenAICompatibleProvider) send(ctx context.Context, client *http.Client, requestBody map[string]interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.config.BaseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for name, value := range p.config.Headers {
+		req.Header.Set(name, value)
+	}
+	if p.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, newTransportError(ctx, p.name, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newHTTPError(p.name, resp, body)
+	}
+	return resp, nil
 }
 
 // GeminiProvider implements AIProvider for Google Gemini
 type GeminiProvider struct {
-	apiKey     string
-	httpClient *http.Client
+	apiKey       string
+	baseURL      string
+	httpClient   *http.Client
+	streamClient *http.Client
 }
 
 // NewGeminiProvider creates a new Gemini provider
-func NewGeminiProvider(apiKey string) *GeminiProvider {
+func NewGeminiProvider(apiKey string, timeout time.Duration) *GeminiProvider {
+	httpClient, streamClient := newHTTPClients(timeout)
 	return &GeminiProvider{
-		apiKey:     apiKey,
-		httpClient: &http.Client{},
+		apiKey:       apiKey,
+		baseURL:      "https://generativelanguage.googleapis.com/v1beta",
+		httpClient:   httpClient,
+		streamClient: streamClient,
 	}
 }
 
-// GenerateCompletion generates text using Gemini
-func (p *GeminiProvider) GenerateCompletion(ctx context.Context, prompt string, model string) (string, error) {
-	if model == "" {
-		model = "gemini-1.5-pro-latest" // Default Gemini model
+// GenerateCompletion generates text using Gemini. Gemini schemas cannot contain
+// references, so recursive response schemas are reported as unsupported.
+func (p *GeminiProvider) GenerateCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	requestBody, err := p.requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.send(ctx, p.httpClient, req.Model, "generateContent", "", requestBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if err := response.blocked(); err != nil {
+		return nil, err
+	}
+
+	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("no response from Gemini")
+	}
+
+	var text strings.Builder
+	for _, part := range response.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return &CompletionResponse{
+		Text:         text.String(),
+		FinishReason: response.Candidates[0].FinishReason,
+		Provider:     ProviderGemini,
+		Model:        firstNonEmpty(response.ModelVersion, geminiModel(req.Model)),
+		Usage:        response.UsageMetadata.toUsage(),
+	}, nil
+}
+
+// StreamCompletion streams text from Gemini's streamGenerateContent
+func (p *GeminiProvider) StreamCompletion(ctx context.Context, req *CompletionRequest, onDelta func(delta string) error) (*CompletionResponse, error) {
+	requestBody, err := p.requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.send(ctx, p.streamClient, req.Model, "streamGenerateContent", "alt=sse", requestBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	result := &CompletionResponse{Provider: ProviderGemini, Model: geminiModel(req.Model)}
+	err = readSSE(resp.Body, func(data string) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+		if err := chunk.blocked(); err != nil {
+			return err
+		}
+		if chunk.ModelVersion != "" {
+			result.Model = chunk.ModelVersion
+		}
+		// Every chunk carries the running totals
+		if chunk.UsageMetadata != nil {
+			result.Usage = chunk.UsageMetadata.toUsage()
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+		if reason := chunk.Candidates[0].FinishReason; reason != "" {
+			result.FinishReason = reason
+		}
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			text.WriteString(part.Text)
+			if err := onDelta(part.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Text = text.String()
+	return result, nil
+}
+
+// requestBody maps a completion request to a Gemini generateContent body. System messages
+// become the system instruction and assistant messages are sent with the "model" role.
+func (p *GeminiProvider) requestBody(req *CompletionRequest) (map[string]interface{}, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	var system []string
+	contents := make([]map[string]interface{}, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		role := "user"
+		switch m.Role {
+		case RoleSystem:
+			system = append(system, m.Content)
+			continue
+		case RoleAssistant:
+			role = "model"
+		}
+		contents = append(contents, map[string]interface{}{
+			"role": role,
+			"parts": []map[string]string{
+				{
+					"text": m.Content,
+				},
+			},
+		})
 	}
 
 	requestBody := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{
-						"text": prompt,
-					},
+		"contents": contents,
+	}
+	if len(system) > 0 {
+		requestBody["systemInstruction"] = map[string]interface{}{
+			"parts": []map[string]string{
+				{
+					"text": strings.Join(system, "\n\n"),
 				},
 			},
-		},
+		}
+	}
+
+	generationConfig := map[string]interface{}{}
+	if req.Params.Temperature != nil {
+		generationConfig["temperature"] = *req.Params.Temperature
+	}
+	if req.Params.MaxTokens != nil {
+		generationConfig["maxOutputTokens"] = *req.Params.MaxTokens
 	}
+	if len(req.Params.Stop) > 0 {
+		generationConfig["stopSequences"] = req.Params.Stop
+	}
+	if req.Params.Seed != nil {
+		generationConfig["seed"] = *req.Params.Seed
+	}
+	if req.ResponseSchema != nil {
+		responseSchema, ok := toGeminiSchema(req.ResponseSchema.Schema)
+		if !ok {
+			return nil, ErrStructuredOutputUnsupported
+		}
+		generationConfig["responseMimeType"] = "application/json"
+		generationConfig["responseSchema"] = responseSchema
+	}
+	if len(generationConfig) > 0 {
+		requestBody["generationConfig"] = generationConfig
+	}
+	return requestBody, nil
+}
+
+// geminiModel returns the Gemini model to call for a requested model
+func geminiModel(model string) string {
+	if model == "" {
+		return "gemini-1.5-pro-latest" // Default Gemini model
+	}
+	return model
+}
+
+// geminiResponse is a generateContent response or streamed chunk
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata *geminiUsage `json:"usageMetadata"`
+	ModelVersion  string       `json:"modelVersion"`
+}
+
+// geminiUsage is the usageMetadata block of a Gemini response
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+}
+
+func (u *geminiUsage) toUsage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: u.PromptTokenCount, CompletionTokens: u.CandidatesTokenCount}
+}
+
+// geminiBlockReasons are finish reasons Gemini reports when it withholds a response
+var geminiBlockReasons = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+}
+
+// blocked returns a content filter error if Gemini blocked the prompt or the response
+func (r *geminiResponse) blocked() error {
+	if r.PromptFeedback.BlockReason != "" {
+		return newContentFilterError(ProviderGemini, r.PromptFeedback.BlockReason)
+	}
+	if len(r.Candidates) > 0 && geminiBlockReasons[r.Candidates[0].FinishReason] {
+		return newContentFilterError(ProviderGemini, r.Candidates[0].FinishReason)
+	}
+	return nil
+}
+
+// send posts a request to a Gemini model method and returns the response if it succeeded.
+// query carries extra URL parameters. The API key goes in a header, keeping it out of the
+// URL and so out of error messages.
+func (p *GeminiProvider) send(ctx context.Context, client *http.Client, model, method, query string, requestBody map[string]interface{}) (*http.Response, error) {
+	model = geminiModel(model)
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, p.apiKey)
+	url := fmt.Sprintf("%s/models/%s:%s", p.baseURL, model, method)
+	if query != "" {
+		url += "?" + query
+	}
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", p.apiKey)
 
-	resp, err := p.httpClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return nil, newTransportError(ctx, ProviderGemini, err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Gemini API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, newHTTPError(ProviderGemini, resp, body)
 	}
+	return resp, nil
+}
 
-	var response struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-		} `json:"candidates"`
+// toGeminiSchema converts a JSON schema to Gemini's OpenAPI-style responseSchema.
+// It drops keywords Gemini does not accept and reports false for schemas that use
+// references or type lists, which Gemini cannot express.
+func toGeminiSchema(schema map[string]interface{}) (map[string]interface{}, bool) {
+	out := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		switch key {
+		case "$ref", "$defs":
+			return nil, false
+		case "additionalProperties":
+			continue
+		case "type":
+			if _, ok := value.(string); !ok {
+				return nil, false
+			}
+			out[key] = value
+		case "properties":
+			props, _ := value.(map[string]interface{})
+			converted := make(map[string]interface{}, len(props))
+			for name, prop := range props {
+				propSchema, _ := prop.(map[string]interface{})
+				c, ok := toGeminiSchema(propSchema)
+				if !ok {
+					return nil, false
+				}
+				converted[name] = c
+			}
+			out[key] = converted
+		case "items":
+			itemSchema, _ := value.(map[string]interface{})
+			c, ok := toGeminiSchema(itemSchema)
+			if !ok {
+				return nil, false
+			}
+			out[key] = c
+		default:
+			out[key] = value
+		}
 	}
+	return out, true
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
+// AIService provides AI capabilities using configured provider
+type AIService struct {
+	provider  AIProvider
+	usageRepo *repository.AIUsageRepository
+	modelRepo *repository.ModelRepository
+	prices    PriceTable
+
+	// cache is nil when caching is disabled. Keys include providerNames, since a different
+	// provider chain may answer differently.
+	cache         CompletionCache
+	cacheCounters cacheCounters
+	providerNames []string
+}
 
-	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no response from Gemini")
+// AIConfig configures the providers behind an AIService
+type AIConfig struct {
+	// Provider is the primary provider; FallbackProviders are tried in order after it
+	Provider          string
+	FallbackProviders []string
+	OpenRouterAPIKey  string
+	// OpenRouterBaseURL overrides OpenRouter's API URL, e.g. for a proxy
+	OpenRouterBaseURL string
+	GeminiAPIKey      string
+	OpenAICompatible  OpenAICompatibleConfig
+	Replay            ReplayConfig
+	Timeout           time.Duration
+	Retry             RetryPolicy
+	// Prices estimate the cost of each call for usage accounting
+	Prices PriceTable
+	// Cache, if set, serves repeated requests without calling a provider
+	Cache CompletionCache
+	// Limits throttle the calls made to each provider and model, including retries
+	Limits RateLimits
+}
+
+// NewAIService creates a new AI service. Requests naming a model in modelRepo's catalog use
+// its provider, provider model string and default parameters.
+func NewAIService(cfg AIConfig, usageRepo *repository.AIUsageRepository, modelRepo *repository.ModelRepository) (*AIService, error) {
+	var chain []NamedProvider
+	limiter := NewRateLimiter(cfg.Limits)
+	names := append([]string{cfg.Provider}, cfg.FallbackProviders...)
+	for _, name := range names {
+		provider, err := newProvider(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, NamedProvider{Name: name, Provider: limiter.wrap(name, provider)})
 	}
 
-	return response.Candidates[0].Content.Parts[0].Text, nil
+	return &AIService{
+		provider:      NewResilientProvider(chain, cfg.Retry),
+		usageRepo:     usageRepo,
+		modelRepo:     modelRepo,
+		prices:        cfg.Prices,
+		cache:         cfg.Cache,
+		providerNames: names,
+	}, nil
 }
 
-// AIService provides AI capabilities using configured provider
-type AIService struct {
-	provider AIProvider
+// newProvider creates the provider with the given name
+func newProvider(name string, cfg AIConfig) (AIProvider, error) {
+	switch name {
+	case ProviderOpenRouter:
+		return NewOpenRouterProvider(cfg.OpenRouterAPIKey, cfg.OpenRouterBaseURL, cfg.Timeout), nil
+	case ProviderOpenAICompatible:
+		return NewOpenAICompatibleProvider(ProviderOpenAICompatible, cfg.OpenAICompatible, cfg.Timeout), nil
+	case ProviderGemini:
+		return NewGeminiProvider(cfg.GeminiAPIKey, cfg.Timeout), nil
+	case ProviderReplay:
+		var upstream AIProvider
+		if cfg.Replay.Upstream != "" {
+			if cfg.Replay.Upstream == ProviderReplay {
+				return nil, fmt.Errorf("replay provider cannot record from itself")
+			}
+			var err error
+			if upstream, err = newProvider(cfg.Replay.Upstream, cfg); err != nil {
+				return nil, err
+			}
+		}
+		return NewReplayProvider(cfg.Replay, upstream)
+	default:
+		return nil, fmt.Errorf("unsupported AI provider: %s", name)
+	}
 }
 
-// NewAIService creates a new AI service
-func NewAIService(providerType, openRouterKey, geminiKey string) (*AIService, error) {
-	var provider AIProvider
+// Complete completes a conversation using the configured AI provider and records its usage.
+// Cached responses are returned without calling the provider or recording usage.
+func (s *AIService) Complete(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	req, err := s.applyCatalog(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	key, cached := s.cachedCompletion(ctx, req)
+	if cached != nil {
+		return cached, nil
+	}
 
-	switch providerType {
-	case "openrouter":
-		provider = NewOpenRouterProvider(openRouterKey)
-	case "gemini":
-		provider = NewGeminiProvider(geminiKey)
-	default:
-		return nil, fmt.Errorf("unsupported AI provider: %s", providerType)
+	start := time.Now()
+	resp, err := s.provider.GenerateCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	s.recordUsage(ctx, req, resp, time.Since(start))
+	s.storeCompletion(ctx, key, resp)
+	return resp, nil
+}
+
+// Stream completes a conversation using the configured AI provider, passing deltas to
+// onDelta, and records its usage. A cached response is passed to onDelta in one piece.
+func (s *AIService) Stream(ctx context.Context, req *CompletionRequest, onDelta func(delta string) error) (*CompletionResponse, error) {
+	req, err := s.applyCatalog(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	key, cached := s.cachedCompletion(ctx, req)
+	if cached != nil {
+		if err := onDelta(cached.Text); err != nil {
+			return nil, err
+		}
+		return cached, nil
 	}
 
-	return &AIService{provider: provider}, nil
+	start := time.Now()
+	resp, err := s.provider.StreamCompletion(ctx, req, onDelta)
+	if err != nil {
+		return nil, err
+	}
+	s.recordUsage(ctx, req, resp, time.Since(start))
+	s.storeCompletion(ctx, key, resp)
+	return resp, nil
 }
 
-// GenerateText generates text using the configured AI provider
+// GenerateText generates text for a single prompt using the configured AI provider
 func (s *AIService) GenerateText(ctx context.Context, prompt string, model string) (string, error) {
-	return s.provider.GenerateCompletion(ctx, prompt, model)
+	resp, err := s.Complete(ctx, UserPrompt(model, prompt))
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// extractJSON returns the outermost JSON object or array found in text
+func extractJSON(text string) string {
+	start := strings.IndexAny(text, "{[")
+	if start == -1 {
+		return text
+	}
+	closer := "}"
+	if text[start] == '[' {
+		closer = "]"
+	}
+	end := strings.LastIndex(text, closer)
+	if end < start {
+		return text[start:]
+	}
+	return text[start : end+1]
+}
+
+// stripCodeFences removes a surrounding markdown code fence from generated code
+func stripCodeFences(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	// Drop the opening fence line, which may carry a language tag
+	if i := strings.Index(text, "\n"); i != -1 {
+		text = text[i+1:]
+	} else {
+		return ""
+	}
+	text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	return strings.TrimSpace(text)
 }
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+)
+
+// Completion cache backends, as used for AI_CACHE
+const (
+	CacheBackendPostgres   = "postgres"
+	CacheBackendFilesystem = "filesystem"
+)
+
+// CompletionCache stores completions by request key
+type CompletionCache interface {
+	// Get returns the response stored under key, or nil if there is none or it expired
+	Get(ctx context.Context, key string) (*CompletionResponse, error)
+	Put(ctx context.Context, key string, resp *CompletionResponse) error
+	// DeleteExpired removes expired entries and returns how many were removed
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+// NewCompletionCache creates the cache backend with the given name, or returns nil when
+// backend is empty. Entries expire after ttl, or never if it is zero.
+func NewCompletionCache(backend string, repo *repository.AICacheRepository, dir string, ttl time.Duration) (CompletionCache, error) {
+	switch backend {
+	case "":
+		return nil, nil
+	case CacheBackendPostgres:
+		return NewPostgresCache(repo, ttl), nil
+	case CacheBackendFilesystem:
+		return NewFileCache(dir, ttl)
+	default:
+		return nil, fmt.Errorf("unsupported AI cache backend: %s", backend)
+	}
+}
+
+// CacheStats counts cache lookups since the service started
+type CacheStats struct {
+	Enabled  bool  `json:"enabled"`
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Bypassed int64 `json:"bypassed"`
+}
+
+// cacheCounters are the live counters behind CacheStats
+type cacheCounters struct {
+	hits, misses, bypassed atomic.Int64
+}
+
+// cacheKey hashes everything that determines a completion: the providers that may serve
+// it, the provider it asks for, the model, the messages, the parameters and the response
+// schema
+func cacheKey(providers []string, req *CompletionRequest) (string, error) {
+	data, err := json.Marshal(struct {
+		Providers      []string         `json:"providers"`
+		Provider       string           `json:"provider,omitempty"`
+		Model          string           `json:"model"`
+		Messages       []Message        `json:"messages"`
+		Params         GenerationParams `json:"params"`
+		ResponseSchema *ResponseSchema  `json:"responseSchema"`
+	}{providers, req.Provider, req.Model, req.Messages, req.Params, req.ResponseSchema})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash completion request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type cacheBypassKey struct{}
+
+// WithCacheBypass makes AI calls made under ctx skip the completion cache lookup, as if
+// each request set BypassCache
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
+
+// cachedCompletion looks req up in the cache. It returns the key to store the response
+// under, which is empty when caching is disabled, and the cached response on a hit.
+func (s *AIService) cachedCompletion(ctx context.Context, req *CompletionRequest) (string, *CompletionResponse) {
+	if s.cache == nil {
+		return "", nil
+	}
+	key, err := cacheKey(s.providerNames, req)
+	if err != nil {
+		log.Printf("AI cache disabled for request: %v", err)
+		return "", nil
+	}
+	if req.BypassCache || cacheBypassed(ctx) {
+		s.cacheCounters.bypassed.Add(1)
+		return key, nil
+	}
+
+	resp, err := s.cache.Get(ctx, key)
+	if err != nil {
+		// A broken cache must not stop generation, so treat it as a miss
+		log.Printf("AI cache lookup failed: %v", err)
+	}
+	if resp == nil {
+		s.cacheCounters.misses.Add(1)
+		return key, nil
+	}
+	s.cacheCounters.hits.Add(1)
+	return key, resp
+}
+
+// storeCompletion caches a response under key, if caching is enabled
+func (s *AIService) storeCompletion(ctx context.Context, key string, resp *CompletionResponse) {
+	if key == "" {
+		return
+	}
+	if err := s.cache.Put(context.WithoutCancel(ctx), key, resp); err != nil {
+		log.Printf("AI cache store failed: %v", err)
+	}
+}
+
+// CacheStats returns the completion cache counters
+func (s *AIService) CacheStats() CacheStats {
+	return CacheStats{
+		Enabled:  s.cache != nil,
+		Hits:     s.cacheCounters.hits.Load(),
+		Misses:   s.cacheCounters.misses.Load(),
+		Bypassed: s.cacheCounters.bypassed.Load(),
+	}
+}
+
+// PostgresCache stores completions in the ai_completion_cache table
+type PostgresCache struct {
+	repo *repository.AICacheRepository
+	ttl  time.Duration
+}
+
+// NewPostgresCache creates a completion cache backed by Postgres
+func NewPostgresCache(repo *repository.AICacheRepository, ttl time.Duration) *PostgresCache {
+	return &PostgresCache{repo: repo, ttl: ttl}
+}
+
+// Get returns the cached response for key, or nil
+func (c *PostgresCache) Get(ctx context.Context, key string) (*CompletionResponse, error) {
+	data, err := c.repo.Get(ctx, key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var resp CompletionResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode cached completion: %w", err)
+	}
+	return &resp, nil
+}
+
+// Put caches resp under key
+func (c *PostgresCache) Put(ctx context.Context, key string, resp *CompletionResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to encode completion: %w", err)
+	}
+	return c.repo.Put(ctx, key, data, c.ttl)
+}
+
+// DeleteExpired removes expired rows
+func (c *PostgresCache) DeleteExpired(ctx context.Context) (int, error) {
+	n, err := c.repo.DeleteExpired(ctx)
+	return int(n), err
+}
+
+// FileCache stores each completion as a JSON file in a directory
+type FileCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// fileCacheEntry is the content of a FileCache file
+type fileCacheEntry struct {
+	ExpiresAt *time.Time          `json:"expiresAt,omitempty"`
+	Response  *CompletionResponse `json:"response"`
+}
+
+// NewFileCache creates a completion cache in dir, creating the directory if needed
+func NewFileCache(dir string, ttl time.Duration) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create AI cache directory: %w", err)
+	}
+	return &FileCache{dir: dir, ttl: ttl}, nil
+}
+
+// Get returns the cached response for key, or nil
+func (c *FileCache) Get(ctx context.Context, key string) (*CompletionResponse, error) {
+	entry, err := c.read(c.path(key))
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	if entry.expired(time.Now()) {
+		return nil, nil
+	}
+	return entry.Response, nil
+}
+
+// Put caches resp under key. The file is written to a temporary name and renamed, so
+// concurrent readers never see a partial entry.
+func (c *FileCache) Put(ctx context.Context, key string, resp *CompletionResponse) error {
+	entry := fileCacheEntry{Response: resp}
+	if c.ttl > 0 {
+		expiresAt := time.Now().Add(c.ttl)
+		entry.ExpiresAt = &expiresAt
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode completion: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to cache completion: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to cache completion: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to cache completion: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		return fmt.Errorf("failed to cache completion: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes expired and unreadable files
+func (c *FileCache) DeleteExpired(ctx context.Context) (int, error) {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read AI cache directory: %w", err)
+	}
+	now := time.Now()
+	removed := 0
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(c.dir, file.Name())
+		entry, err := c.read(path)
+		if err == nil && entry != nil && !entry.expired(now) {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (c *FileCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// read decodes the entry at path, returning nil if the file does not exist
+func (c *FileCache) read(path string) (*fileCacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached completion: %w", err)
+	}
+	var entry fileCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode cached completion: %w", err)
+	}
+	return &entry, nil
+}
+
+func (e *fileCacheEntry) expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
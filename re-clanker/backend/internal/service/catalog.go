@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// ErrContextWindowExceeded is returned for a request too long for its model's context window
+var ErrContextWindowExceeded = errors.New("request does not fit the model's context window")
+
+// catalogEntry is what a request took from the model catalog, for usage accounting
+type catalogEntry struct {
+	modelID  uuid.UUID
+	provider string
+	price    *ModelPrice
+}
+
+// applyCatalog resolves a request's model in the catalog. A catalog model is sent to its
+// provider under its provider model string, with its default parameters filling those the
+// request leaves unset. Models the catalog does not know are sent as they are. In a
+// pipeline step the model is not allowed for, the provider's default model is used instead.
+func (s *AIService) applyCatalog(ctx context.Context, req *CompletionRequest) (*CompletionRequest, error) {
+	if s.modelRepo == nil || req.Model == "" {
+		return req, nil
+	}
+	model, err := s.modelRepo.GetByName(ctx, req.Model)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return req, nil
+	}
+
+	resolved := *req
+	if step := usageScopeFrom(ctx).Step; step != nil && !model.AllowsStep(*step) {
+		log.Printf("Model %s is not allowed for step %s, using the provider default", model.Name, *step)
+		resolved.Model = ""
+		return &resolved, nil
+	}
+
+	if model.ProviderModel != nil && *model.ProviderModel != "" {
+		resolved.Model = *model.ProviderModel
+	}
+	if model.Provider != nil {
+		resolved.Provider = *model.Provider
+	}
+	if model.DefaultParams != nil {
+		resolved.Params = withDefaultParams(req.Params, *model.DefaultParams)
+	}
+	resolved.catalog = &catalogEntry{
+		modelID:  model.ID,
+		provider: firstNonEmpty(resolved.Provider, s.providerNames[0]),
+		price:    catalogPrice(model),
+	}
+
+	if model.ContextWindow != nil {
+		if tokens := estimateTokens(&resolved); tokens > *model.ContextWindow {
+			return nil, fmt.Errorf("%w: about %d tokens for the %d tokens of %s",
+				ErrContextWindowExceeded, tokens, *model.ContextWindow, model.Name)
+		}
+	}
+	return &resolved, nil
+}
+
+// withDefaultParams fills the parameters params leaves unset from a model's defaults
+func withDefaultParams(params GenerationParams, defaults models.ModelParams) GenerationParams {
+	if params.Temperature == nil {
+		params.Temperature = defaults.Temperature
+	}
+	if params.MaxTokens == nil {
+		params.MaxTokens = defaults.MaxTokens
+	}
+	if params.Stop == nil {
+		params.Stop = defaults.Stop
+	}
+	if params.Seed == nil {
+		params.Seed = defaults.Seed
+	}
+	return params
+}
+
+// catalogPrice converts a model's per-token prices, or returns nil if it has none
+func catalogPrice(model *models.Model) *ModelPrice {
+	if model.PromptPricePerToken == nil && model.CompletionPricePerToken == nil {
+		return nil
+	}
+	var price ModelPrice
+	if model.PromptPricePerToken != nil {
+		price.PromptPerMillion = *model.PromptPricePerToken * 1e6
+	}
+	if model.CompletionPricePerToken != nil {
+		price.CompletionPerMillion = *model.CompletionPricePerToken * 1e6
+	}
+	return &price
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Role is the author of a message in a conversation
+type Role string
+
+// Message roles understood by every provider
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// Message is a single turn of a conversation
+type Message struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+}
+
+// GenerationParams tune how a completion is sampled. Nil and empty fields are left to the
+// provider's defaults.
+type GenerationParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"maxTokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+}
+
+// CompletionRequest is a conversation to complete. System messages may appear anywhere,
+// but providers that take a single system instruction merge them in order.
+type CompletionRequest struct {
+	// Provider, if set, sends the request to the named provider first. The model catalog
+	// sets it for models bound to a provider.
+	Provider string
+	Model    string
+	Messages []Message
+	Params   GenerationParams
+	// ResponseSchema, if set, asks the provider to constrain the output with its native
+	// structured output. Providers return ErrStructuredOutputUnsupported when they cannot
+	// express the schema, so the caller can fall back to prompting.
+	ResponseSchema *ResponseSchema
+	// BypassCache skips the completion cache lookup. The fresh response still replaces
+	// the cached one. WithCacheBypass sets it for every request made under a context.
+	BypassCache bool
+
+	// catalog is set once the model has been resolved in the model catalog
+	catalog *catalogEntry
+}
+
+// CompletionResponse is the text a provider generated for a request
+type CompletionResponse struct {
+	Text string
+	// FinishReason is the provider's own reason for stopping, such as "stop" from OpenRouter
+	// or "MAX_TOKENS" from Gemini
+	FinishReason string
+	// Provider and Model identify what actually served the request, which may differ from
+	// the requested model after defaults and fallbacks
+	Provider string
+	Model    string
+	Usage    Usage
+}
+
+// Usage is the token usage a provider reported for a completion
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	// CostUSD is the cost reported by the provider, if it reports one
+	CostUSD *float64
+}
+
+// ErrEmptyConversation is returned for a request without user or assistant messages
+var ErrEmptyConversation = errors.New("completion request has no user or assistant messages")
+
+// UserPrompt builds a request consisting of a single user message
+func UserPrompt(model, prompt string) *CompletionRequest {
+	return &CompletionRequest{
+		Model:    model,
+		Messages: []Message{{Role: RoleUser, Content: prompt}},
+	}
+}
+
+// validate checks the roles of the request's messages
+func (r *CompletionRequest) validate() error {
+	turns := 0
+	for i, m := range r.Messages {
+		switch m.Role {
+		case RoleSystem:
+		case RoleUser, RoleAssistant:
+			turns++
+		default:
+			return fmt.Errorf("message %d has unknown role %q", i, m.Role)
+		}
+	}
+	if turns == 0 {
+		return ErrEmptyConversation
+	}
+	return nil
+}
+
+// withFollowUp returns a copy of the request extended with the given turns
+func (r *CompletionRequest) withFollowUp(turns ...Message) *CompletionRequest {
+	next := *r
+	next.Messages = append(append([]Message(nil), r.Messages...), turns...)
+	return &next
+}
+
+// withSchemaInstructions returns a copy of the request whose last user message spells out
+// the response schema, for providers without native structured output
+func (r *CompletionRequest) withSchemaInstructions() *CompletionRequest {
+	next := *r
+	next.ResponseSchema = nil
+	next.Messages = append([]Message(nil), r.Messages...)
+	for i := len(next.Messages) - 1; i >= 0; i-- {
+		if next.Messages[i].Role == RoleUser {
+			next.Messages[i].Content = withSchemaInstructions(next.Messages[i].Content, r.ResponseSchema)
+			break
+		}
+	}
+	return &next
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// validateJSONSchema checks a decoded JSON value against the subset of JSON Schema used
+// for structured output: type, properties, required, additionalProperties, items,
+// minItems, maxItems, enum, anyOf and local $ref into $defs
+func validateJSONSchema(schema map[string]interface{}, value interface{}) error {
+	return (&schemaValidator{root: schema}).check(schema, value, "$", 0)
+}
+
+type schemaValidator struct {
+	root map[string]interface{}
+}
+
+func (v *schemaValidator) check(schema map[string]interface{}, value interface{}, path string, depth int) error {
+	if depth > 64 {
+		return fmt.Errorf("%s: value is nested too deeply", path)
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return v.check(resolved, value, path, depth+1)
+	}
+
+	if alternatives, ok := schema["anyOf"].([]interface{}); ok {
+		var errs []string
+		for _, alt := range alternatives {
+			altSchema, _ := alt.(map[string]interface{})
+			err := v.check(altSchema, value, path, depth+1)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("%s: matches no allowed alternative (%s)", path, strings.Join(errs, "; "))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, allowed := range enum {
+			if allowed == value {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: must be one of %v", path, enum)
+		}
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		return fmt.Errorf("%s: expected %v", path, t)
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := val[fmt.Sprint(name)]; !ok {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+		for name, field := range val {
+			fieldPath := path + "." + name
+			if propSchema, ok := properties[name].(map[string]interface{}); ok {
+				if err := v.check(propSchema, field, fieldPath, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s: unexpected property", fieldPath)
+				}
+			case map[string]interface{}:
+				if err := v.check(additional, field, fieldPath, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if minItems, ok := schema["minItems"].(float64); ok && float64(len(val)) < minItems {
+			return fmt.Errorf("%s: expected at least %v items, got %d", path, minItems, len(val))
+		}
+		if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(val)) > maxItems {
+			return fmt.Errorf("%s: expected at most %v items, got %d", path, maxItems, len(val))
+		}
+		if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				if err := v.check(itemSchema, item, fmt.Sprintf("%s[%d]", path, i), depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolve looks up a local "#/$defs/Name" reference
+func (v *schemaValidator) resolve(ref string) (map[string]interface{}, error) {
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	defs, _ := v.root["$defs"].(map[string]interface{})
+	def, ok := defs[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("undefined $ref %q", ref)
+	}
+	return def, nil
+}
+
+// matchesType reports whether value has the JSON Schema type t (a name or list of names)
+func matchesType(t interface{}, value interface{}) bool {
+	if list, ok := t.([]interface{}); ok {
+		for _, name := range list {
+			if matchesType(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	}
+	return false
+}
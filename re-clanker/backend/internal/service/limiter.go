@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// RateLimit bounds the calls made to a provider or model. Zero fields are unlimited.
+type RateLimit struct {
+	// Concurrency is the number of requests in flight at once
+	Concurrency       int `json:"concurrency"`
+	RequestsPerMinute int `json:"requestsPerMinute"`
+	// TokensPerMinute counts prompt and completion tokens. Prompts are estimated before a
+	// call and corrected with the usage the provider reports.
+	TokensPerMinute int `json:"tokensPerMinute"`
+}
+
+// RateLimits are the limits per provider name and per requested model name
+type RateLimits struct {
+	Providers map[string]RateLimit `json:"providers"`
+	Models    map[string]RateLimit `json:"models"`
+}
+
+// LoadRateLimits reads a JSON rate limit file such as
+// {"providers": {"openrouter": {"concurrency": 4, "tokensPerMinute": 200000}},
+// "models": {"anthropic/claude-3.5-sonnet": {"requestsPerMinute": 50}}}.
+// An empty path gives no limits.
+func LoadRateLimits(path string) (RateLimits, error) {
+	if path == "" {
+		return RateLimits{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RateLimits{}, fmt.Errorf("failed to read rate limits: %w", err)
+	}
+	var limits RateLimits
+	if err := json.Unmarshal(data, &limits); err != nil {
+		return RateLimits{}, fmt.Errorf("failed to parse rate limits %s: %w", path, err)
+	}
+	for name, limit := range limits.Providers {
+		if err := limit.validate(); err != nil {
+			return RateLimits{}, fmt.Errorf("invalid rate limit for provider %s: %w", name, err)
+		}
+	}
+	for name, limit := range limits.Models {
+		if err := limit.validate(); err != nil {
+			return RateLimits{}, fmt.Errorf("invalid rate limit for model %s: %w", name, err)
+		}
+	}
+	return limits, nil
+}
+
+func (l RateLimit) validate() error {
+	if l.Concurrency < 0 || l.RequestsPerMinute < 0 || l.TokensPerMinute < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// limiter enforces a RateLimit. Callers are admitted strictly in arrival order: the
+// caller at the head of the queue holds turn while it waits for capacity, and channel
+// senders are served first in, first out.
+type limiter struct {
+	turn     chan struct{}
+	slots    chan struct{}
+	requests *tokenBucket
+	tokens   *tokenBucket
+}
+
+func newLimiter(l RateLimit) *limiter {
+	lim := &limiter{turn: make(chan struct{}, 1)}
+	if l.Concurrency > 0 {
+		lim.slots = make(chan struct{}, l.Concurrency)
+	}
+	if l.RequestsPerMinute > 0 {
+		lim.requests = newTokenBucket(l.RequestsPerMinute)
+	}
+	if l.TokensPerMinute > 0 {
+		lim.tokens = newTokenBucket(l.TokensPerMinute)
+	}
+	return lim
+}
+
+// acquire waits until a call estimated at the given number of tokens may start. The
+// returned release must be called with the tokens the call actually used.
+func (l *limiter) acquire(ctx context.Context, tokens int) (release func(used int), err error) {
+	select {
+	case l.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-l.turn }()
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	releaseSlot := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	if l.requests != nil {
+		if err := l.requests.wait(ctx, 1); err != nil {
+			releaseSlot()
+			return nil, err
+		}
+	}
+	if l.tokens != nil {
+		if err := l.tokens.wait(ctx, tokens); err != nil {
+			releaseSlot()
+			return nil, err
+		}
+	}
+
+	return func(used int) {
+		if l.tokens != nil {
+			l.tokens.adjust(tokens - used)
+		}
+		releaseSlot()
+	}, nil
+}
+
+// tokenBucket refills perMinute units evenly over a minute, holding at most perMinute
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	perSec   float64
+	level    float64
+	updated  time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		perSec:   float64(perMinute) / 60,
+		level:    float64(perMinute),
+		updated:  time.Now(),
+	}
+}
+
+// wait takes n units, sleeping until they are available. Requests larger than the whole
+// bucket wait for a full bucket instead of forever.
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	need := min(float64(n), b.capacity)
+	for {
+		b.mu.Lock()
+		b.refill()
+		if b.level >= need {
+			b.level -= need
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((need - b.level) / b.perSec * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// adjust returns n units to the bucket, or takes them when n is negative. The level may go
+// below zero, which delays later callers until the overuse has been paid back.
+func (b *tokenBucket) adjust(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.level = min(b.level+float64(n), b.capacity)
+}
+
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.level = min(b.level+now.Sub(b.updated).Seconds()*b.perSec, b.capacity)
+	b.updated = now
+}
+
+// RateLimiter holds the limiters for every configured provider and model. Model limits
+// are shared by all providers.
+type RateLimiter struct {
+	providers map[string]*limiter
+	models    map[string]*limiter
+}
+
+// NewRateLimiter creates limiters for the given limits
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	rl := &RateLimiter{providers: map[string]*limiter{}, models: map[string]*limiter{}}
+	for name, limit := range limits.Providers {
+		rl.providers[name] = newLimiter(limit)
+	}
+	for name, limit := range limits.Models {
+		rl.models[name] = newLimiter(limit)
+	}
+	return rl
+}
+
+// wrap limits the calls made to a provider, or returns it unchanged when neither it nor
+// any model is limited
+func (rl *RateLimiter) wrap(name string, provider AIProvider) AIProvider {
+	if rl.providers[name] == nil && len(rl.models) == 0 {
+		return provider
+	}
+	return &limitedProvider{provider: provider, limiter: rl.providers[name], models: rl.models}
+}
+
+// limitedProvider implements AIProvider by waiting for its provider's and the requested
+// model's limits before each call
+type limitedProvider struct {
+	provider AIProvider
+	limiter  *limiter
+	models   map[string]*limiter
+}
+
+// GenerateCompletion completes a conversation once the limits allow it
+func (p *limitedProvider) GenerateCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	release, err := p.acquire(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.provider.GenerateCompletion(ctx, req)
+	release(resp)
+	return resp, err
+}
+
+// StreamCompletion streams a completion once the limits allow it. The concurrency slot is
+// held until the stream ends.
+func (p *limitedProvider) StreamCompletion(ctx context.Context, req *CompletionRequest, onDelta func(delta string) error) (*CompletionResponse, error) {
+	release, err := p.acquire(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.provider.StreamCompletion(ctx, req, onDelta)
+	release(resp)
+	return resp, err
+}
+
+// acquire waits for the provider limit and then the model limit. It returns a release
+// that settles the token estimate with the usage in resp, if any.
+func (p *limitedProvider) acquire(ctx context.Context, req *CompletionRequest) (func(resp *CompletionResponse), error) {
+	estimate := estimateTokens(req)
+	var releases []func(used int)
+	releaseAll := func(used int) {
+		for _, release := range releases {
+			release(used)
+		}
+	}
+
+	for _, lim := range []*limiter{p.limiter, p.models[req.Model]} {
+		if lim == nil {
+			continue
+		}
+		release, err := lim.acquire(ctx, estimate)
+		if err != nil {
+			releaseAll(estimate)
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+
+	return func(resp *CompletionResponse) {
+		used := estimate
+		if resp != nil && resp.Usage.PromptTokens+resp.Usage.CompletionTokens > 0 {
+			used = resp.Usage.PromptTokens + resp.Usage.CompletionTokens
+		}
+		releaseAll(used)
+	}, nil
+}
+
+// estimateTokens guesses the tokens a request will use from its length, at about four
+// characters per token, plus its completion limit
+func estimateTokens(req *CompletionRequest) int {
+	chars := 0
+	for _, m := range req.Messages {
+		chars += len(m.Content)
+	}
+	tokens := chars/4 + 1
+	if req.Params.MaxTokens != nil {
+		tokens += *req.Params.MaxTokens
+	}
+	return tokens
+}
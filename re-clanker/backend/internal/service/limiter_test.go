@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRateLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"valid", `{"providers": {"openrouter": {"concurrency": 4}}, "models": {"m": {"requestsPerMinute": 50}}}`, ""},
+		{"empty", `{}`, ""},
+		{"malformed", `{"providers": [`, "failed to parse rate limits"},
+		{"negative provider limit", `{"providers": {"openrouter": {"tokensPerMinute": -1}}}`, "invalid rate limit for provider openrouter"},
+		{"negative model limit", `{"models": {"m": {"concurrency": -2}}}`, "invalid rate limit for model m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "limits.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadRateLimits(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadRateLimits() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadRateLimits() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if limits, err := LoadRateLimits(""); err != nil || limits.Providers != nil || limits.Models != nil {
+		t.Errorf("LoadRateLimits(\"\") = %+v, %v, want no limits", limits, err)
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute int
+		level     float64
+		// age is how long ago the bucket was last refilled
+		age  time.Duration
+		n    int
+		wait bool
+	}{
+		{"full bucket", 60, 60, 0, 1, false},
+		{"empty bucket", 60, 0, 0, 1, true},
+		{"partly refilled", 60, 0, 30 * time.Second, 30, false},
+		{"not refilled enough", 60, 0, 30 * time.Second, 40, true},
+		{"request larger than the bucket waits for a full bucket", 60, 60, 0, 1000, false},
+		{"overuse is paid back first", 60, -10, 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(tt.perMinute)
+			b.level = tt.level
+			b.updated = time.Now().Add(-tt.age)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := b.wait(ctx, tt.n)
+			if tt.wait && !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("wait(%d) = %v, want it to block", tt.n, err)
+			}
+			if !tt.wait && err != nil {
+				t.Fatalf("wait(%d) = %v, want nil", tt.n, err)
+			}
+		})
+	}
+}
+
+func TestTokenBucketAdjust(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     float64
+		n         int
+		wantLevel float64
+	}{
+		{"returns unused units", 10, 20, 30},
+		{"level is capped", 50, 20, 60},
+		{"overuse goes below zero", 10, -30, -20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(60)
+			b.level = tt.level
+			b.adjust(tt.n)
+			// Allow for the refill since the bucket was created
+			if b.level < tt.wantLevel || b.level > tt.wantLevel+0.1 {
+				t.Errorf("level = %v, want %v", b.level, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	lim := newLimiter(RateLimit{Concurrency: 1})
+	release, err := lim.acquire(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := lim.acquire(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire() with no free slot = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	release(1)
+	if _, err := lim.acquire(context.Background(), 1); err != nil {
+		t.Fatalf("acquire() after release = %v, want nil", err)
+	}
+}
+
+// A caller that gives up waiting for tokens must not keep its concurrency slot
+func TestLimiterReleasesSlotOnTimeout(t *testing.T) {
+	lim := newLimiter(RateLimit{Concurrency: 1, TokensPerMinute: 60})
+	release, err := lim.acquire(context.Background(), 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(60)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := lim.acquire(ctx, 60); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire() with an empty bucket = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(lim.slots) != 0 {
+		t.Errorf("%d slots held after a failed acquire, want 0", len(lim.slots))
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	maxTokens := 100
+	tests := []struct {
+		name string
+		req  *CompletionRequest
+		want int
+	}{
+		{"empty", &CompletionRequest{}, 1},
+		{"four characters per token", &CompletionRequest{Messages: []Message{{Content: "12345678"}, {Content: "1234"}}}, 4},
+		{"completion limit", &CompletionRequest{Messages: []Message{{Content: "1234"}}, Params: GenerationParams{MaxTokens: &maxTokens}}, 102},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateTokens(tt.req); got != tt.want {
+				t.Errorf("estimateTokens() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// usageProvider reports a fixed token usage for every call
+type usageProvider struct {
+	usage Usage
+}
+
+func (p *usageProvider) GenerateCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	return &CompletionResponse{Text: "ok", Usage: p.usage}, nil
+}
+
+func (p *usageProvider) StreamCompletion(ctx context.Context, req *CompletionRequest, onDelta func(delta string) error) (*CompletionResponse, error) {
+	return p.GenerateCompletion(ctx, req)
+}
+
+func TestLimitedProviderSettlesUsage(t *testing.T) {
+	maxTokens := 1000
+	req := &CompletionRequest{Model: "m", Messages: []Message{{Content: "1234"}}, Params: GenerationParams{MaxTokens: &maxTokens}}
+	tests := []struct {
+		name  string
+		usage Usage
+		// wantSpent is the number of tokens taken from the bucket after the call
+		wantSpent float64
+	}{
+		{"reported usage replaces the estimate", Usage{PromptTokens: 30, CompletionTokens: 20}, 50},
+		{"estimate is kept without usage", Usage{}, float64(estimateTokens(req))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimiter(RateLimits{
+				Providers: map[string]RateLimit{"p": {TokensPerMinute: 60000}},
+				Models:    map[string]RateLimit{"m": {TokensPerMinute: 60000}},
+			})
+			provider := rl.wrap("p", &usageProvider{usage: tt.usage})
+			if _, err := provider.GenerateCompletion(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			for name, lim := range map[string]*limiter{"provider": rl.providers["p"], "model": rl.models["m"]} {
+				spent := 60000 - lim.tokens.level
+				// Allow for the refill during the test, at 1000 tokens a second
+				if spent > tt.wantSpent || spent < tt.wantSpent-100 {
+					t.Errorf("%s bucket spent %v tokens, want %v", name, spent, tt.wantSpent)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterWrap(t *testing.T) {
+	provider := &usageProvider{}
+	if got := NewRateLimiter(RateLimits{}).wrap("p", provider); got != AIProvider(provider) {
+		t.Error("wrap() without limits changed the provider")
+	}
+	limited := NewRateLimiter(RateLimits{Models: map[string]RateLimit{"m": {Concurrency: 1}}})
+	if got := limited.wrap("p", provider); got == AIProvider(provider) {
+		t.Error("wrap() with a model limit returned the provider unchanged")
+	}
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// GenerationStep names one stage of the problem generation pipeline
+type GenerationStep string
+
+// Generation steps, named after the steps and actions of the original TypeScript workflow
+const (
+	StepGenerateProblemText       GenerationStep = "generateProblemText"
+	StepParseFunctionSignature    GenerationStep = "parseFunctionSignature"
+	StepGenerateTestCases         GenerationStep = "generateTestCases"
+	StepGenerateTestCaseInputCode GenerationStep = "generateTestCaseInputCode"
+	StepGenerateTestCaseInputs    GenerationStep = "generateTestCaseInputs"
+	StepGenerateSolution          GenerationStep = "generateSolution"
+	StepGenerateTestCaseOutputs   GenerationStep = "generateTestCaseOutputs"
+	StepRewordProblemText         GenerationStep = "rewordProblemText"
+)
+
+// StepOrder is the order in which generation steps run (STEP_ORDER in the TS workflow).
+// Each step only depends on artifacts written by the steps before it.
+var StepOrder = []GenerationStep{
+	StepGenerateProblemText,
+	StepParseFunctionSignature,
+	StepGenerateTestCases,
+	StepGenerateTestCaseInputCode,
+	StepGenerateTestCaseInputs,
+	StepGenerateSolution,
+	StepGenerateTestCaseOutputs,
+	StepRewordProblemText,
+}
+
+// ProcessJob runs the generation pipeline for a claimed job, recording progress on the job row.
+// Steps already listed in the job's completed steps are skipped.
+// The job must already be marked in_progress (see GenerationJobRepository.ClaimPending).
+func (s *ProblemService) ProcessJob(ctx context.Context, job *models.GenerationJob) error {
+	ctx = withUsageJob(ctx, job)
+	if job.BypassCache {
+		ctx = WithCacheBypass(ctx)
+	}
+
+	model, err := s.resolveModelName(ctx, job.ModelID)
+	if err != nil {
+		return s.failJob(ctx, job, "", err)
+	}
+
+	completed := make(map[string]bool, len(job.CompletedSteps))
+	for _, step := range job.CompletedSteps {
+		completed[step] = true
+	}
+
+	lastStep := ""
+	for _, step := range StepOrder {
+		lastStep = string(step)
+		if completed[string(step)] {
+			continue
+		}
+
+		if err := s.jobRepo.UpdateStatus(ctx, job.ID, "in_progress", string(step), nil); err != nil {
+			return s.failJob(ctx, job, string(step), err)
+		}
+		if err := s.runStep(ctx, step, job.ProblemID, model); err != nil {
+			return s.failJob(ctx, job, string(step), fmt.Errorf("%s: %w", step, err))
+		}
+		if err := s.jobRepo.MarkStepComplete(ctx, job.ID, string(step)); err != nil {
+			return s.failJob(ctx, job, string(step), err)
+		}
+	}
+
+	if err := s.jobRepo.UpdateStatus(ctx, job.ID, "completed", lastStep, nil); err != nil {
+		return fmt.Errorf("failed to mark generation job completed: %w", err)
+	}
+	return nil
+}
+
+// runStep dispatches a single generation step
+func (s *ProblemService) runStep(ctx context.Context, step GenerationStep, problemID uuid.UUID, model string) error {
+	ctx = withUsageStep(ctx, problemID, step)
+	switch step {
+	case StepGenerateProblemText:
+		return s.GenerateProblemText(ctx, problemID, model)
+	case StepParseFunctionSignature:
+		return s.ParseFunctionSignature(ctx, problemID, model)
+	case StepGenerateTestCases:
+		return s.GenerateTestCases(ctx, problemID, model)
+	case StepGenerateTestCaseInputCode:
+		return s.GenerateTestCaseInputCode(ctx, problemID, model)
+	case StepGenerateTestCaseInputs:
+		return s.GenerateTestCaseInputs(ctx, problemID)
+	case StepGenerateSolution:
+		return s.GenerateSolution(ctx, problemID, model)
+	case StepGenerateTestCaseOutputs:
+		return s.GenerateTestCaseOutputs(ctx, problemID)
+	case StepRewordProblemText:
+		_, err := s.RewordProblemText(ctx, problemID, model)
+		return err
+	default:
+		return fmt.Errorf("unknown generation step: %s", step)
+	}
+}
+
+// failJob records a step failure on the job. If the failure was caused by shutdown
+// the job is put back to pending so another worker can resume it.
+func (s *ProblemService) failJob(ctx context.Context, job *models.GenerationJob, step string, cause error) error {
+	// The job context may already be cancelled, so record the outcome on a fresh one
+	statusCtx := context.WithoutCancel(ctx)
+
+	if errors.Is(cause, context.Canceled) && ctx.Err() != nil {
+		if err := s.jobRepo.UpdateStatus(statusCtx, job.ID, "pending", step, nil); err != nil {
+			log.Printf("Failed to requeue generation job %s: %v", job.ID, err)
+		}
+		return cause
+	}
+
+	errMsg := cause.Error()
+	if err := s.jobRepo.UpdateStatus(statusCtx, job.ID, "failed", step, &errMsg); err != nil {
+		log.Printf("Failed to mark generation job %s as failed: %v", job.ID, err)
+	}
+	return cause
+}
+
+// LookupModel finds an active model by ID or name, returning ErrUnknownModel if it is not
+// registered or has been deactivated
+func (s *ProblemService) LookupModel(ctx context.Context, ref string) (*models.Model, error) {
+	var model *models.Model
+	if id, err := uuid.Parse(ref); err == nil {
+		if model, err = s.modelRepo.GetByID(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if model == nil {
+		var err error
+		if model, err = s.modelRepo.GetByName(ctx, ref); err != nil {
+			return nil, err
+		}
+	}
+	if model == nil || !model.IsActive {
+		return nil, fmt.Errorf("%w: %q is not one of the available models", ErrUnknownModel, ref)
+	}
+	return model, nil
+}
+
+// resolveModelName returns the model name for a job, or "" to use the provider default
+func (s *ProblemService) resolveModelName(ctx context.Context, modelID *uuid.UUID) (string, error) {
+	if modelID == nil {
+		return "", nil
+	}
+	model, err := s.modelRepo.GetByID(ctx, *modelID)
+	if err != nil {
+		return "", err
+	}
+	if model == nil {
+		return "", fmt.Errorf("model not found: %s", *modelID)
+	}
+	return model.Name, nil
+}
+
+// Errors returned by EnqueueGeneration
+var (
+	ErrInvalidStep          = errors.New("invalid generation step")
+	ErrUnknownModel         = errors.New("unknown model")
+	ErrGenerationInProgress = errors.New("a generation job is already running for this problem")
+	ErrMissingArtifacts     = errors.New("problem is missing artifacts from earlier steps")
+)
+
+// ParseGenerationStep validates a step name. An empty name selects the first step.
+func ParseGenerationStep(name string) (GenerationStep, error) {
+	if name == "" {
+		return StepOrder[0], nil
+	}
+	for _, step := range StepOrder {
+		if string(step) == name {
+			return step, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrInvalidStep, name)
+}
+
+// EnqueueGeneration creates a pending job that (re-)runs the pipeline from startingStep.
+// Steps before startingStep are recorded as complete so their stored artifacts are reused.
+// modelRef is a model ID or name; the model is also recorded as the problem's generating
+// model. If modelRef is empty, the model of the problem's previous job is used.
+// The job bypasses the completion cache if bypassCache is set or startingStep already has
+// output, since re-running a step should not replay the completion it was built from.
+func (s *ProblemService) EnqueueGeneration(ctx context.Context, problemID uuid.UUID, startingStep GenerationStep, modelRef string, bypassCache bool) (uuid.UUID, error) {
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	latest, err := s.jobRepo.GetLatestForProblem(ctx, problemID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if latest != nil && (latest.Status == "pending" || latest.Status == "in_progress") {
+		return uuid.Nil, ErrGenerationInProgress
+	}
+
+	var modelID *uuid.UUID
+	if modelRef != "" {
+		model, err := s.LookupModel(ctx, modelRef)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		modelID = &model.ID
+	} else if latest != nil {
+		modelID = latest.ModelID
+	}
+
+	var skipped []string
+	for _, step := range StepOrder {
+		if step == startingStep {
+			break
+		}
+		if err := checkStepArtifacts(step, problem); err != nil {
+			return uuid.Nil, fmt.Errorf("%w: %v", ErrMissingArtifacts, err)
+		}
+		skipped = append(skipped, string(step))
+	}
+
+	if checkStepArtifacts(startingStep, problem) == nil {
+		bypassCache = true
+	}
+
+	// The active job check at the top is only a fast path; concurrent requests are
+	// serialized by the unique index on active jobs
+	jobID, err := s.jobRepo.CreateWithCompletedSteps(ctx, problemID, modelID, skipped, bypassCache)
+	if errors.Is(err, repository.ErrActiveGenerationJob) {
+		return uuid.Nil, ErrGenerationInProgress
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if modelID != nil {
+		updates := map[string]interface{}{"generatedByModelId": *modelID}
+		if err := s.problemRepo.Update(ctx, problemID, updates); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	return jobID, nil
+}
+
+// checkStepArtifacts reports whether the output of a step is stored on the problem
+func checkStepArtifacts(step GenerationStep, problem *models.ProblemWithTestCases) error {
+	switch step {
+	case StepGenerateProblemText:
+		if problem.ProblemText == "" || problem.FunctionSignature == "" {
+			return fmt.Errorf("%s has not produced problem text", step)
+		}
+	case StepParseFunctionSignature:
+		if problem.FunctionSignatureSchema == nil {
+			return fmt.Errorf("%s has not produced a function signature schema", step)
+		}
+	case StepGenerateTestCases:
+		if len(problem.TestCases) == 0 {
+			return fmt.Errorf("%s has not produced test cases", step)
+		}
+	case StepGenerateTestCaseInputCode:
+		for _, tc := range problem.TestCases {
+			if tc.InputCode == nil || *tc.InputCode == "" {
+				return fmt.Errorf("%s has not produced input code for every test case", step)
+			}
+		}
+	case StepGenerateTestCaseInputs:
+		for _, tc := range problem.TestCases {
+			if tc.Input == nil {
+				return fmt.Errorf("%s has not produced an input for every test case", step)
+			}
+		}
+	case StepGenerateSolution:
+		if problem.Solution == nil || *problem.Solution == "" {
+			return fmt.Errorf("%s has not produced a solution", step)
+		}
+	case StepGenerateTestCaseOutputs:
+		for _, tc := range problem.TestCases {
+			if !tc.HasExpected && tc.ExpectedError == nil {
+				return fmt.Errorf("%s has not produced an expected output for every test case", step)
+			}
+		}
+	case StepRewordProblemText:
+		if problem.ProblemTextReworded == "" {
+			return fmt.Errorf("%s has not produced reworded text", step)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+)
+
+// A function whose return type allows null may legitimately have a null expected output,
+// which must count as produced
+func TestCheckTestCaseOutputs(t *testing.T) {
+	failure := "reference solution exited with code 1"
+	tests := []struct {
+		name     string
+		testCase models.TestCase
+		wantErr  bool
+	}{
+		{"output", models.TestCase{Expected: 3.0, HasExpected: true}, false},
+		{"null output of a nullable return type", models.TestCase{Expected: nil, HasExpected: true}, false},
+		{"reference solution failed", models.TestCase{ExpectedError: &failure}, false},
+		{"not produced", models.TestCase{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := &models.ProblemWithTestCases{TestCases: []models.TestCase{
+				{Expected: 1.0, HasExpected: true},
+				tt.testCase,
+			}}
+			err := checkStepArtifacts(StepGenerateTestCaseOutputs, problem)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkStepArtifacts() = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,53 +3,375 @@ package service
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/executor"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/prompts"
 	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/runner"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
 	"github.com/google/uuid"
 )
 
 // ProblemService handles problem generation logic
 type ProblemService struct {
 	problemRepo *repository.ProblemRepository
+	focusRepo   *repository.FocusAreaRepository
+	modelRepo   *repository.ModelRepository
 	jobRepo     *repository.GenerationJobRepository
 	aiService   *AIService
+	executor    *executor.Executor
+	runners     *runner.Registry
+	prompts     *prompts.Renderer
+	// solutionLanguage is the language new reference solutions are generated in
+	solutionLanguage string
 }
 
 // NewProblemService creates a new problem service
 func NewProblemService(
 	problemRepo *repository.ProblemRepository,
+	focusRepo *repository.FocusAreaRepository,
+	modelRepo *repository.ModelRepository,
 	jobRepo *repository.GenerationJobRepository,
 	aiService *AIService,
+	executor *executor.Executor,
+	runners *runner.Registry,
+	prompts *prompts.Renderer,
+	solutionLanguage string,
 ) *ProblemService {
 	return &ProblemService{
-		problemRepo: problemRepo,
-		jobRepo:     jobRepo,
-		aiService:   aiService,
+		problemRepo:      problemRepo,
+		focusRepo:        focusRepo,
+		modelRepo:        modelRepo,
+		jobRepo:          jobRepo,
+		aiService:        aiService,
+		executor:         executor,
+		runners:          runners,
+		prompts:          prompts,
+		solutionLanguage: solutionLanguage,
 	}
 }
 
-// GenerateProblemText generates problem text using AI
-func (s *ProblemService) GenerateProblemText(ctx context.Context, problemID uuid.UUID, focusAreas []string, model string) error {
-	// Build prompt based on focus areas
-	prompt := "Generate a coding interview problem"
-	if len(focusAreas) > 0 {
-		prompt += fmt.Sprintf(" focusing on: %v", focusAreas)
+// renderPrompt renders a prompt template for a problem along with its focus areas
+func (s *ProblemService) renderPrompt(ctx context.Context, name string, problem *models.ProblemWithTestCases, vars map[string]interface{}) (string, error) {
+	focusAreas, err := s.focusRepo.GetForProblem(ctx, problem.ID)
+	if err != nil {
+		return "", err
+	}
+	solutionRunner, err := s.runners.Get(s.solutionLanguage)
+	if err != nil {
+		return "", err
 	}
-	prompt += ". Include a clear problem statement, input/output format, and examples."
+	return s.prompts.Render(ctx, name, &prompts.Data{
+		Problem:    problem,
+		FocusAreas: focusAreas,
+		Language:   solutionRunner.Name,
+		Vars:       vars,
+	})
+}
 
-	// Generate text using AI
-	problemText, err := s.aiService.GenerateText(ctx, prompt, model)
+// problemTextSchema is the structured output of the problem text step
+var problemTextSchema = &ResponseSchema{
+	Name: "problem_text",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"problemText":       map[string]interface{}{"type": "string"},
+			"functionSignature": map[string]interface{}{"type": "string"},
+		},
+		"required":             []interface{}{"problemText", "functionSignature"},
+		"additionalProperties": false,
+	},
+}
+
+// ProblemText is the generated problem statement and function signature
+type ProblemText struct {
+	ProblemText       string `json:"problemText"`
+	FunctionSignature string `json:"functionSignature"`
+}
+
+// validate checks that neither part of the generated problem text is empty
+func (t *ProblemText) validate() error {
+	if strings.TrimSpace(t.ProblemText) == "" || strings.TrimSpace(t.FunctionSignature) == "" {
+		return fmt.Errorf("problemText and functionSignature must not be empty")
+	}
+	return nil
+}
+
+// GenerateProblemText generates the problem statement and function signature using AI,
+// guided by the prompt guidance of the problem's focus areas
+func (s *ProblemService) GenerateProblemText(ctx context.Context, problemID uuid.UUID, model string) error {
+	prompt, err := s.problemTextPrompt(ctx, problemID)
 	if err != nil {
+		return err
+	}
+
+	// Generate text using AI
+	var result ProblemText
+	if err := s.aiService.GenerateObject(ctx, UserPrompt(model, prompt), problemTextSchema, &result, result.validate); err != nil {
 		return fmt.Errorf("failed to generate problem text: %w", err)
 	}
 
-	// Update problem in database
+	return s.saveProblemText(ctx, problemID, &result)
+}
+
+// StreamProblemText generates the problem text like GenerateProblemText, passing the raw
+// response to onDelta as it is produced. Streamed output cannot be retried, so a malformed
+// response fails instead of being regenerated.
+func (s *ProblemService) StreamProblemText(ctx context.Context, problemID uuid.UUID, model string, onDelta func(delta string) error) (*ProblemText, error) {
+	ctx = withUsageStep(ctx, problemID, StepGenerateProblemText)
+
+	prompt, err := s.problemTextPrompt(ctx, problemID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ProblemText
+	if err := s.aiService.StreamObject(ctx, UserPrompt(model, prompt), problemTextSchema, &result, result.validate, onDelta); err != nil {
+		return nil, fmt.Errorf("failed to generate problem text: %w", err)
+	}
+	if err := s.saveProblemText(ctx, problemID, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// problemTextPrompt renders the problem text prompt. Variants are written relative to the
+// problem they were derived from.
+func (s *ProblemService) problemTextPrompt(ctx context.Context, problemID uuid.UUID) (string, error) {
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get problem: %w", err)
+	}
+
+	base, direction, err := s.variantBase(ctx, problem)
+	if err != nil {
+		return "", err
+	}
+	baseText := ""
+	if base != nil {
+		baseText = base.ProblemText
+	}
+
+	// Build prompt based on focus areas
+	return s.renderPrompt(ctx, prompts.GenerateProblemText, problem, map[string]interface{}{
+		"BaseProblemText": baseText,
+		"Direction":       direction,
+	})
+}
+
+// saveProblemText stores generated problem text on the problem
+func (s *ProblemService) saveProblemText(ctx context.Context, problemID uuid.UUID, result *ProblemText) error {
 	updates := map[string]interface{}{
-		"problemText": problemText,
+		"problemText":       result.ProblemText,
+		"functionSignature": result.FunctionSignature,
 	}
 	if err := s.problemRepo.Update(ctx, problemID, updates); err != nil {
 		return fmt.Errorf("failed to update problem: %w", err)
 	}
+	return nil
+}
+
+// functionSignatureSchemaSchema is the structured output of the signature parsing step
+var functionSignatureSchemaSchema = &ResponseSchema{
+	Name:   "function_signature_schema",
+	Schema: signature.JSONSchema(),
+}
+
+// ParseFunctionSignature converts the problem's function signature into a typed schema.
+// The AI performs the parse and the result is then checked against the fixed type grammar.
+func (s *ProblemService) ParseFunctionSignature(ctx context.Context, problemID uuid.UUID, model string) error {
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return fmt.Errorf("failed to get problem: %w", err)
+	}
+	if problem.FunctionSignature == "" {
+		return fmt.Errorf("problem has no function signature")
+	}
+
+	prompt, err := s.renderPrompt(ctx, prompts.ParseFunctionSignature, problem, nil)
+	if err != nil {
+		return err
+	}
+
+	var parsed signature.FunctionSignatureSchema
+	validate := func() error {
+		if parsed.FunctionName == "" {
+			parsed.FunctionName = "runSolution"
+		}
+		return signature.Validate(&parsed)
+	}
+	if err := s.aiService.GenerateObject(ctx, UserPrompt(model, prompt), functionSignatureSchemaSchema, &parsed, validate); err != nil {
+		return fmt.Errorf("failed to parse function signature: %w", err)
+	}
+
+	schema, err := parsed.ToMap()
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{
+		"functionSignatureSchema": schema,
+	}
+	if err := s.problemRepo.Update(ctx, problemID, updates); err != nil {
+		return fmt.Errorf("failed to update problem with function signature schema: %w", err)
+	}
+
+	return nil
+}
+
+// Bounds on the number of test cases accepted from the model
+const (
+	minTestCases = 3
+	maxTestCases = 30
+)
+
+// testCasesSchema is the structured output of the test case step
+var testCasesSchema = &ResponseSchema{
+	Name: "test_cases",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"testCases": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"description":  map[string]interface{}{"type": "string"},
+						"isEdgeCase":   map[string]interface{}{"type": "boolean"},
+						"isSampleCase": map[string]interface{}{"type": "boolean"},
+					},
+					"required":             []interface{}{"description", "isEdgeCase", "isSampleCase"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []interface{}{"testCases"},
+		"additionalProperties": false,
+	},
+}
+
+// testCaseDescription is the structured form the model returns for each test case
+type testCaseDescription struct {
+	Description  string `json:"description"`
+	IsEdgeCase   bool   `json:"isEdgeCase"`
+	IsSampleCase bool   `json:"isSampleCase"`
+}
+
+// GenerateTestCases generates test case descriptions for the problem using AI and
+// replaces the problem's existing test cases with them
+func (s *ProblemService) GenerateTestCases(ctx context.Context, problemID uuid.UUID, model string) error {
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return fmt.Errorf("failed to get problem: %w", err)
+	}
+	if problem.ProblemText == "" {
+		return fmt.Errorf("problem has no problem text")
+	}
+
+	prompt, err := s.renderPrompt(ctx, prompts.GenerateTestCases, problem, map[string]interface{}{
+		"MinTestCases": minTestCases,
+		"MaxTestCases": maxTestCases,
+	})
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		TestCases []testCaseDescription `json:"testCases"`
+	}
+	validate := func() error {
+		return validateTestCaseDescriptions(result.TestCases)
+	}
+	if err := s.aiService.GenerateObject(ctx, UserPrompt(model, prompt), testCasesSchema, &result, validate); err != nil {
+		return fmt.Errorf("failed to generate test cases: %w", err)
+	}
+	descriptions := result.TestCases
+
+	testCases := make([]models.TestCase, 0, len(descriptions))
+	for _, d := range descriptions {
+		testCases = append(testCases, models.TestCase{
+			ProblemID:    problemID,
+			Description:  strings.TrimSpace(d.Description),
+			IsEdgeCase:   d.IsEdgeCase,
+			IsSampleCase: d.IsSampleCase,
+		})
+	}
+	if _, err := s.problemRepo.ReplaceTestCases(ctx, problemID, testCases); err != nil {
+		return fmt.Errorf("failed to save test cases: %w", err)
+	}
+
+	return nil
+}
+
+// validateTestCaseDescriptions checks the structured test case list returned by the model
+func validateTestCaseDescriptions(descriptions []testCaseDescription) error {
+	if len(descriptions) < minTestCases || len(descriptions) > maxTestCases {
+		return fmt.Errorf("expected between %d and %d test cases, got %d", minTestCases, maxTestCases, len(descriptions))
+	}
+	hasSample := false
+	for i, d := range descriptions {
+		if strings.TrimSpace(d.Description) == "" {
+			return fmt.Errorf("test case %d has an empty description", i+1)
+		}
+		hasSample = hasSample || d.IsSampleCase
+	}
+	if !hasSample {
+		return fmt.Errorf("no test case is marked as a sample case")
+	}
+	return nil
+}
+
+// inputCodesSchema is the structured output of the input code step
+var inputCodesSchema = &ResponseSchema{
+	Name: "test_case_input_code",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"inputCodes": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		},
+		"required":             []interface{}{"inputCodes"},
+		"additionalProperties": false,
+	},
+}
+
+// GenerateTestCaseInputCode generates, for every test case, code that produces its input
+func (s *ProblemService) GenerateTestCaseInputCode(ctx context.Context, problemID uuid.UUID, model string) error {
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return fmt.Errorf("failed to get problem: %w", err)
+	}
+	if len(problem.TestCases) == 0 {
+		return fmt.Errorf("problem has no test cases")
+	}
+
+	prompt, err := s.renderPrompt(ctx, prompts.GenerateTestCaseInputCode, problem, nil)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		InputCodes []string `json:"inputCodes"`
+	}
+	validate := func() error {
+		if len(result.InputCodes) != len(problem.TestCases) {
+			return fmt.Errorf("expected %d input programs, got %d", len(problem.TestCases), len(result.InputCodes))
+		}
+		return nil
+	}
+	if err := s.aiService.GenerateObject(ctx, UserPrompt(model, prompt), inputCodesSchema, &result, validate); err != nil {
+		return fmt.Errorf("failed to generate test case input code: %w", err)
+	}
+	inputCodes := result.InputCodes
+
+	for i, tc := range problem.TestCases {
+		if err := s.problemRepo.UpdateTestCaseInputCode(ctx, tc.ID, stripCodeFences(inputCodes[i])); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -61,9 +383,15 @@ func (s *ProblemService) GenerateSolution(ctx context.Context, problemID uuid.UU
 	if err != nil {
 		return fmt.Errorf("failed to get problem: %w", err)
 	}
+	if problem.ProblemText == "" {
+		return fmt.Errorf("problem has no problem text")
+	}
 
 	// Build prompt
-	prompt := fmt.Sprintf("Generate a solution in Python for this problem:\n\n%s\n\nProvide only the code.", problem.ProblemText)
+	prompt, err := s.renderPrompt(ctx, prompts.GenerateSolution, problem, nil)
+	if err != nil {
+		return err
+	}
 
 	// Generate solution using AI
 	solution, err := s.aiService.GenerateText(ctx, prompt, model)
@@ -73,7 +401,8 @@ func (s *ProblemService) GenerateSolution(ctx context.Context, problemID uuid.UU
 
 	// Update problem with solution
 	updates := map[string]interface{}{
-		"solution": solution,
+		"solution":         stripCodeFences(solution),
+		"solutionLanguage": s.solutionLanguage,
 	}
 	if err := s.problemRepo.Update(ctx, problemID, updates); err != nil {
 		return fmt.Errorf("failed to update problem with solution: %w", err)
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorKind classifies a failed AI provider call by how it should be handled
+type ErrorKind string
+
+// Provider error kinds
+const (
+	// ErrorKindRateLimit is a 429 or quota error; retry after a delay
+	ErrorKindRateLimit ErrorKind = "rate_limit"
+	// ErrorKindAuth is a missing, invalid or unauthorized API key; do not retry
+	ErrorKindAuth ErrorKind = "auth"
+	// ErrorKindContentFilter is a prompt or response blocked by moderation; do not retry
+	ErrorKindContentFilter ErrorKind = "content_filter"
+	// ErrorKindServer is a 5xx, overload or network error; retry after a delay
+	ErrorKindServer ErrorKind = "server"
+	// ErrorKindInvalidRequest is any other rejected request; do not retry
+	ErrorKindInvalidRequest ErrorKind = "invalid_request"
+)
+
+// ProviderError is a failed call to an AI provider
+type ProviderError struct {
+	Provider   string
+	Kind       ErrorKind
+	StatusCode int
+	// RetryAfter is the delay the provider asked for, if any
+	RetryAfter time.Duration
+	Message    string
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s API error (%s, status %d): %s", e.Provider, e.Kind, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s API error (%s): %s", e.Provider, e.Kind, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the same call may succeed if repeated later
+func (e *ProviderError) Retryable() bool {
+	return e.Kind == ErrorKindRateLimit || e.Kind == ErrorKindServer
+}
+
+// errorKindOf returns the kind of a provider error, or "" for other errors
+func errorKindOf(err error) ErrorKind {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.Kind
+	}
+	return ""
+}
+
+// contentFilterMarkers are substrings of error bodies that indicate a moderation block
+var contentFilterMarkers = []string{"content_filter", "content policy", "moderation", "flagged", "SAFETY", "PROHIBITED_CONTENT"}
+
+// newHTTPError classifies a non-200 response from a provider
+func newHTTPError(provider string, resp *http.Response, body []byte) *ProviderError {
+	message := string(body)
+	kind := ErrorKindInvalidRequest
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		kind = ErrorKindRateLimit
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode >= 500:
+		kind = ErrorKindServer
+	case containsAny(message, contentFilterMarkers):
+		kind = ErrorKindContentFilter
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden,
+		resp.StatusCode == http.StatusPaymentRequired, strings.Contains(message, "API_KEY_INVALID"):
+		kind = ErrorKindAuth
+	}
+
+	return &ProviderError{
+		Provider:   provider,
+		Kind:       kind,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		Message:    message,
+	}
+}
+
+// newTransportError wraps a failure to reach a provider, which is worth retrying unless the
+// caller gave up. A client timeout is retried like any other network error. The request URL
+// is dropped from the error, since it can hold credentials.
+func newTransportError(ctx context.Context, provider string, err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	return &ProviderError{
+		Provider: provider,
+		Kind:     ErrorKindServer,
+		Message:  fmt.Sprintf("failed to send request: %v", err),
+		Err:      err,
+	}
+}
+
+// newContentFilterError reports a completion the provider stopped for moderation reasons
+func newContentFilterError(provider, reason string) *ProviderError {
+	return &ProviderError{
+		Provider: provider,
+		Kind:     ErrorKindContentFilter,
+		Message:  fmt.Sprintf("response blocked (%s)", reason),
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
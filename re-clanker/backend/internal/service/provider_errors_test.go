@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGeminiKey = "test-gemini-key-123"
+
+func TestGeminiKeyStaysOutOfURLAndErrors(t *testing.T) {
+	var gotKey, gotQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("x-goog-api-key")
+		gotQuery = r.URL.RawQuery
+		w.Write([]byte(`{"candidates": [{"content": {"parts": [{"text": "hi"}]}, "finishReason": "STOP"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider(testGeminiKey, time.Second)
+	p.baseURL = server.URL
+	req := &CompletionRequest{Model: "gemini-test", Messages: []Message{{Role: RoleUser, Content: "hello"}}}
+	if _, err := p.GenerateCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if gotKey != testGeminiKey {
+		t.Errorf("x-goog-api-key = %q, want %q", gotKey, testGeminiKey)
+	}
+	if strings.Contains(gotQuery, testGeminiKey) {
+		t.Errorf("query %q contains the API key", gotQuery)
+	}
+
+	// A provider that cannot be reached fails with a transport error
+	server.Close()
+	_, err := p.GenerateCompletion(context.Background(), req)
+	if err == nil {
+		t.Fatal("GenerateCompletion() = nil error, want transport error")
+	}
+	if errorKindOf(err) != ErrorKindServer {
+		t.Errorf("error kind = %q, want %q", errorKindOf(err), ErrorKindServer)
+	}
+	if strings.Contains(err.Error(), server.URL) || strings.Contains(err.Error(), testGeminiKey) {
+		t.Errorf("transport error %q contains the request URL", err)
+	}
+}
+
+// A provider slower than the client timeout fails with a retryable error, so the request
+// moves on to the next provider, while a caller that gives up gets its own error back
+func TestTransportErrorOnClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	slow := NewGeminiProvider(testGeminiKey, 20*time.Millisecond)
+	slow.baseURL = server.URL
+	req := &CompletionRequest{Messages: []Message{{Role: RoleUser, Content: "hello"}}}
+
+	_, err := slow.GenerateCompletion(context.Background(), req)
+	if errorKindOf(err) != ErrorKindServer {
+		t.Fatalf("GenerateCompletion() error = %v, want a %s provider error", err, ErrorKindServer)
+	}
+
+	fallback := &scriptedProvider{name: "fallback"}
+	r := NewResilientProvider([]NamedProvider{{"gemini", slow}, {"fallback", fallback}}, RetryPolicy{MaxAttempts: 2})
+	resp, err := r.GenerateCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ResilientProvider.GenerateCompletion() error = %v", err)
+	}
+	if resp.Provider != "fallback" {
+		t.Errorf("served by %q, want fallback", resp.Provider)
+	}
+
+	patient := NewGeminiProvider(testGeminiKey, time.Minute)
+	patient.baseURL = server.URL
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = patient.GenerateCompletion(ctx, req)
+	if !errors.Is(err, context.DeadlineExceeded) || errorKindOf(err) != "" {
+		t.Errorf("GenerateCompletion() after the caller's deadline = %v, want the plain context error", err)
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ProviderReplay serves completions recorded in a cassette directory
+const ProviderReplay = "replay"
+
+// Replay modes, as used for AI_REPLAY_MODE
+const (
+	// ReplayModeReplay serves recorded exchanges. Unrecorded requests go to the upstream
+	// provider and are recorded, unless the provider is strict.
+	ReplayModeReplay = "replay"
+	// ReplayModeRecord sends every request upstream and records it, replacing old recordings
+	ReplayModeRecord = "record"
+)
+
+// ErrNoRecording is returned in strict replay for a request missing from the cassette
+var ErrNoRecording = errors.New("no recorded exchange for request")
+
+// ReplayConfig configures a ReplayProvider
+type ReplayConfig struct {
+	// Dir is the cassette directory, holding one JSON file per recorded exchange
+	Dir  string
+	Mode string
+	// Strict fails unrecorded requests with ErrNoRecording instead of calling Upstream
+	Strict bool
+	// Upstream names the provider that records exchanges
+	Upstream string
+}
+
+// cassetteEntry is a recorded exchange. The request is stored for readers of the
+// cassette; lookups only use the file name.
+type cassetteEntry struct {
+	Request  cassetteRequest     `json:"request"`
+	Response *CompletionResponse `json:"response,omitempty"`
+	Deltas   []string            `json:"deltas,omitempty"`
+	// StructuredOutputUnsupported records that the upstream provider rejected the
+	// response schema, so callers fall back to prompting on replay as well
+	StructuredOutputUnsupported bool      `json:"structuredOutputUnsupported,omitempty"`
+	RecordedAt                  time.Time `json:"recordedAt"`
+}
+
+type cassetteRequest struct {
+	Provider       string           `json:"provider,omitempty"`
+	Model          string           `json:"model,omitempty"`
+	Messages       []Message        `json:"messages"`
+	Params         GenerationParams `json:"params"`
+	ResponseSchema *ResponseSchema  `json:"responseSchema,omitempty"`
+}
+
+// ReplayProvider implements AIProvider by replaying exchanges recorded from an upstream
+// provider. Requests are matched on a hash of their model, messages, parameters and
+// response schema.
+type ReplayProvider struct {
+	config   ReplayConfig
+	upstream AIProvider
+}
+
+// NewReplayProvider creates a replay provider. upstream may be nil when every request is
+// expected to be recorded already.
+func NewReplayProvider(config ReplayConfig, upstream AIProvider) (*ReplayProvider, error) {
+	if config.Mode == "" {
+		config.Mode = ReplayModeReplay
+	}
+	if config.Mode != ReplayModeReplay && config.Mode != ReplayModeRecord {
+		return nil, fmt.Errorf("unsupported replay mode: %s", config.Mode)
+	}
+	if config.Mode == ReplayModeRecord && upstream == nil {
+		return nil, fmt.Errorf("replay mode %s needs an upstream provider", ReplayModeRecord)
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	return &ReplayProvider{config: config, upstream: upstream}, nil
+}
+
+// GenerateCompletion replays or records a completion
+func (p *ReplayProvider) GenerateCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	key, entry, err := p.lookup(req)
+	if err != nil || entry != nil {
+		return p.replayed(entry), err
+	}
+
+	resp, err := p.upstream.GenerateCompletion(ctx, req)
+	if err != nil {
+		return nil, p.recordError(key, req, err)
+	}
+	if err := p.record(key, req, resp, nil); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// StreamCompletion replays or records a stream. Replayed streams send the recorded deltas,
+// or the whole text when the exchange was recorded without streaming.
+func (p *ReplayProvider) StreamCompletion(ctx context.Context, req *CompletionRequest, onDelta func(delta string) error) (*CompletionResponse, error) {
+	key, entry, err := p.lookup(req)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		deltas := entry.Deltas
+		if deltas == nil {
+			deltas = []string{entry.Response.Text}
+		}
+		for _, delta := range deltas {
+			if err := onDelta(delta); err != nil {
+				return nil, err
+			}
+		}
+		return p.replayed(entry), nil
+	}
+
+	var deltas []string
+	resp, err := p.upstream.StreamCompletion(ctx, req, func(delta string) error {
+		deltas = append(deltas, delta)
+		return onDelta(delta)
+	})
+	if err != nil {
+		return nil, p.recordError(key, req, err)
+	}
+	if err := p.record(key, req, resp, deltas); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// lookup returns the cassette key for req and its recording. A nil entry and error mean the
+// request should go upstream.
+func (p *ReplayProvider) lookup(req *CompletionRequest) (string, *cassetteEntry, error) {
+	if err := req.validate(); err != nil {
+		return "", nil, err
+	}
+	key, err := cacheKey(nil, req)
+	if err != nil {
+		return "", nil, err
+	}
+	if p.config.Mode == ReplayModeRecord {
+		return key, nil, nil
+	}
+
+	data, err := os.ReadFile(p.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		if p.config.Strict || p.upstream == nil {
+			return "", nil, fmt.Errorf("%w %s in %s", ErrNoRecording, key, p.config.Dir)
+		}
+		return key, nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read recorded exchange: %w", err)
+	}
+	var entry cassetteEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return "", nil, fmt.Errorf("failed to decode recorded exchange %s: %w", key, err)
+	}
+	if entry.StructuredOutputUnsupported {
+		return "", nil, ErrStructuredOutputUnsupported
+	}
+	if entry.Response == nil {
+		return "", nil, fmt.Errorf("recorded exchange %s has no response", key)
+	}
+	return key, &entry, nil
+}
+
+// replayed returns the recorded response as served by the replay provider. Nothing was
+// spent on it, so it reports no usage.
+func (p *ReplayProvider) replayed(entry *cassetteEntry) *CompletionResponse {
+	if entry == nil {
+		return nil
+	}
+	resp := *entry.Response
+	resp.Provider = ProviderReplay
+	resp.Usage = Usage{}
+	return &resp
+}
+
+// record writes a successful exchange to the cassette
+func (p *ReplayProvider) record(key string, req *CompletionRequest, resp *CompletionResponse, deltas []string) error {
+	return p.write(key, cassetteEntry{Request: newCassetteRequest(req), Response: resp, Deltas: deltas})
+}
+
+// recordError records an upstream error if it is part of the exchange, and returns it.
+// Only ErrStructuredOutputUnsupported is, since callers react to it with another request;
+// other errors are not recorded.
+func (p *ReplayProvider) recordError(key string, req *CompletionRequest, err error) error {
+	if !errors.Is(err, ErrStructuredOutputUnsupported) {
+		return err
+	}
+	if writeErr := p.write(key, cassetteEntry{Request: newCassetteRequest(req), StructuredOutputUnsupported: true}); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+func newCassetteRequest(req *CompletionRequest) cassetteRequest {
+	return cassetteRequest{
+		Provider:       req.Provider,
+		Model:          req.Model,
+		Messages:       req.Messages,
+		Params:         req.Params,
+		ResponseSchema: req.ResponseSchema,
+	}
+}
+
+func (p *ReplayProvider) write(key string, entry cassetteEntry) error {
+	entry.RecordedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode recorded exchange: %w", err)
+	}
+	if err := os.WriteFile(p.path(key), data, 0o644); err != nil {
+		return fmt.Errorf("failed to record exchange: %w", err)
+	}
+	return nil
+}
+
+func (p *ReplayProvider) path(key string) string {
+	return filepath.Join(p.config.Dir, key+".json")
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how ResilientProvider retries a provider before failing over
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls made to each provider, including the first
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry; it doubles with every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff. A Retry-After longer than this fails over instead of waiting.
+	MaxDelay time.Duration
+}
+
+// backoff returns the delay before retry number attempt (starting at 1): exponential in
+// attempt, capped at MaxDelay, with the upper half jittered so clients spread out
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// NamedProvider is a provider in a fallback chain
+type NamedProvider struct {
+	Name     string
+	Provider AIProvider
+}
+
+// ResilientProvider wraps a chain of providers. Rate limit and server errors are retried
+// with backoff, honoring Retry-After; when a provider keeps failing, or fails with an auth
+// or content filter error, the request moves to the next provider in the chain. Fallback
+// providers get the request without its model, since model names are provider-specific.
+type ResilientProvider struct {
+	chain  []NamedProvider
+	policy RetryPolicy
+}
+
+// NewResilientProvider creates a provider that retries and fails over along chain
+func NewResilientProvider(chain []NamedProvider, policy RetryPolicy) *ResilientProvider {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &ResilientProvider{chain: chain, policy: policy}
+}
+
+// GenerateCompletion completes a conversation with the first provider that succeeds
+func (r *ResilientProvider) GenerateCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	return r.do(ctx, req, func(p AIProvider, req *CompletionRequest) (*CompletionResponse, error) {
+		return p.GenerateCompletion(ctx, req)
+	}, nil)
+}
+
+// StreamCompletion streams a completion from the first provider that succeeds. Once a
+// delta has been passed on, a failure is returned as is, since it cannot be taken back.
+func (r *ResilientProvider) StreamCompletion(ctx context.Context, req *CompletionRequest, onDelta func(delta string) error) (*CompletionResponse, error) {
+	started := false
+	forward := func(delta string) error {
+		started = true
+		return onDelta(delta)
+	}
+	return r.do(ctx, req, func(p AIProvider, req *CompletionRequest) (*CompletionResponse, error) {
+		return p.StreamCompletion(ctx, req, forward)
+	}, func() bool { return started })
+}
+
+// do runs call along the chain. committed, if given, reports that output has already been
+// delivered and the call must not be repeated.
+func (r *ResilientProvider) do(
+	ctx context.Context,
+	req *CompletionRequest,
+	call func(p AIProvider, req *CompletionRequest) (*CompletionResponse, error),
+	committed func() bool,
+) (*CompletionResponse, error) {
+	chain, err := r.chainFor(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for i, np := range chain {
+		providerReq := req
+		if i > 0 && req.Model != "" {
+			fallback := *req
+			fallback.Model = ""
+			providerReq = &fallback
+		}
+
+		resp, err := r.retry(ctx, np, providerReq, call, committed)
+		if err == nil {
+			return resp, nil
+		}
+		errs = append(errs, err)
+
+		if !shouldFailOver(err) || (committed != nil && committed()) || i == len(chain)-1 {
+			break
+		}
+		log.Printf("AI provider %s failed, falling back to %s: %v", np.Name, chain[i+1].Name, err)
+	}
+
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, fmt.Errorf("all AI providers failed: %w", errors.Join(errs...))
+}
+
+// chainFor returns the chain starting with the named provider, followed by the others in
+// their configured order. An empty name keeps the configured order.
+func (r *ResilientProvider) chainFor(name string) ([]NamedProvider, error) {
+	if name == "" {
+		return r.chain, nil
+	}
+	for i, np := range r.chain {
+		if np.Name == name {
+			chain := append([]NamedProvider{np}, r.chain[:i]...)
+			return append(chain, r.chain[i+1:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("AI provider %s is not configured; add it to AI_FALLBACK_PROVIDERS", name)
+}
+
+// retry calls a single provider until it succeeds, fails permanently or runs out of attempts
+func (r *ResilientProvider) retry(
+	ctx context.Context,
+	np NamedProvider,
+	req *CompletionRequest,
+	call func(p AIProvider, req *CompletionRequest) (*CompletionResponse, error),
+	committed func() bool,
+) (*CompletionResponse, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := call(np.Provider, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		var providerErr *ProviderError
+		if !errors.As(err, &providerErr) || !providerErr.Retryable() || attempt >= r.policy.MaxAttempts {
+			return nil, err
+		}
+		if committed != nil && committed() {
+			return nil, err
+		}
+
+		delay := r.policy.backoff(attempt)
+		if providerErr.RetryAfter > 0 {
+			if providerErr.RetryAfter > r.policy.MaxDelay {
+				return nil, err
+			}
+			delay = max(delay, providerErr.RetryAfter)
+		}
+		log.Printf("AI provider %s failed (attempt %d/%d), retrying in %v: %v", np.Name, attempt, r.policy.MaxAttempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldFailOver reports whether another provider might succeed where this one failed
+func shouldFailOver(err error) bool {
+	switch errorKindOf(err) {
+	case ErrorKindRateLimit, ErrorKindServer, ErrorKindAuth, ErrorKindContentFilter:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedProvider returns its errors in order, then succeeds
+type scriptedProvider struct {
+	name   string
+	errs   []error
+	models []string
+	// deltas are streamed before a failure or the response
+	deltas []string
+}
+
+func (p *scriptedProvider) GenerateCompletion(ctx context.Context, req *CompletionRequest) (*CompletionResponse, error) {
+	return p.StreamCompletion(ctx, req, func(string) error { return nil })
+}
+
+func (p *scriptedProvider) StreamCompletion(ctx context.Context, req *CompletionRequest, onDelta func(delta string) error) (*CompletionResponse, error) {
+	call := len(p.models)
+	p.models = append(p.models, req.Model)
+	for _, delta := range p.deltas {
+		if err := onDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+	if call < len(p.errs) {
+		return nil, p.errs[call]
+	}
+	return &CompletionResponse{Text: "ok", Provider: p.name}, nil
+}
+
+func providerErr(kind ErrorKind) error {
+	return &ProviderError{Provider: "test", Kind: kind, Message: string(kind)}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{4, 400 * time.Millisecond, 800 * time.Millisecond},
+		{5, 500 * time.Millisecond, time.Second},
+		{50, 500 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if d := policy.backoff(tt.attempt); d < tt.min || d > tt.max {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+
+	if d := (RetryPolicy{}).backoff(3); d != 0 {
+		t.Errorf("backoff without delays = %v, want 0", d)
+	}
+}
+
+func TestResilientProvider(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	tests := []struct {
+		name      string
+		primary   []error
+		fallback  []error
+		requested string
+		// wantProvider served the request; empty means the request fails
+		wantProvider string
+		wantErr      string
+		// wantCalls are the calls made to each provider
+		wantCalls [2]int
+	}{
+		{
+			name:         "success",
+			wantProvider: "primary",
+			wantCalls:    [2]int{1, 0},
+		},
+		{
+			name:         "server errors are retried",
+			primary:      []error{providerErr(ErrorKindServer), providerErr(ErrorKindRateLimit)},
+			wantProvider: "primary",
+			wantCalls:    [2]int{3, 0},
+		},
+		{
+			name:         "exhausted retries fail over",
+			primary:      []error{providerErr(ErrorKindServer), providerErr(ErrorKindServer), providerErr(ErrorKindServer)},
+			wantProvider: "fallback",
+			wantCalls:    [2]int{3, 1},
+		},
+		{
+			name:         "auth errors fail over without retrying",
+			primary:      []error{providerErr(ErrorKindAuth)},
+			wantProvider: "fallback",
+			wantCalls:    [2]int{1, 1},
+		},
+		{
+			name:         "content filter fails over without retrying",
+			primary:      []error{providerErr(ErrorKindContentFilter)},
+			wantProvider: "fallback",
+			wantCalls:    [2]int{1, 1},
+		},
+		{
+			name:      "invalid requests fail without fallback",
+			primary:   []error{providerErr(ErrorKindInvalidRequest)},
+			wantErr:   "invalid_request",
+			wantCalls: [2]int{1, 0},
+		},
+		{
+			name:      "long Retry-After fails over instead of waiting",
+			primary:   []error{&ProviderError{Provider: "test", Kind: ErrorKindRateLimit, RetryAfter: time.Hour}},
+			fallback:  []error{providerErr(ErrorKindAuth)},
+			wantErr:   "all AI providers failed",
+			wantCalls: [2]int{1, 1},
+		},
+		{
+			name:      "other errors are not retried",
+			primary:   []error{errors.New("malformed response")},
+			wantErr:   "malformed response",
+			wantCalls: [2]int{1, 0},
+		},
+		{
+			name:         "requested provider goes first",
+			requested:    "fallback",
+			wantProvider: "fallback",
+			wantCalls:    [2]int{0, 1},
+		},
+		{
+			name:      "unknown provider",
+			requested: "other",
+			wantErr:   "AI provider other is not configured",
+			wantCalls: [2]int{0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &scriptedProvider{name: "primary", errs: tt.primary}
+			fallback := &scriptedProvider{name: "fallback", errs: tt.fallback}
+			r := NewResilientProvider([]NamedProvider{{"primary", primary}, {"fallback", fallback}}, policy)
+
+			resp, err := r.GenerateCompletion(context.Background(), &CompletionRequest{Provider: tt.requested, Model: "some-model"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GenerateCompletion() error = %v, want error containing %q", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("GenerateCompletion() error = %v", err)
+				}
+				if resp.Provider != tt.wantProvider {
+					t.Errorf("served by %q, want %q", resp.Provider, tt.wantProvider)
+				}
+			}
+			if got := [2]int{len(primary.models), len(fallback.models)}; got != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// Model names are provider-specific, so only the first provider in the chain gets the model
+func TestResilientProviderFallbackDropsModel(t *testing.T) {
+	primary := &scriptedProvider{name: "primary", errs: []error{providerErr(ErrorKindAuth)}}
+	fallback := &scriptedProvider{name: "fallback"}
+	r := NewResilientProvider([]NamedProvider{{"primary", primary}, {"fallback", fallback}}, RetryPolicy{MaxAttempts: 1})
+
+	if _, err := r.GenerateCompletion(context.Background(), &CompletionRequest{Model: "primary-model"}); err != nil {
+		t.Fatal(err)
+	}
+	if primary.models[0] != "primary-model" || fallback.models[0] != "" {
+		t.Errorf("models = %q and %q, want primary-model and empty", primary.models[0], fallback.models[0])
+	}
+}
+
+// A stream that already delivered output cannot be retried or moved to another provider
+func TestResilientProviderCommittedStream(t *testing.T) {
+	primary := &scriptedProvider{name: "primary", errs: []error{providerErr(ErrorKindServer)}, deltas: []string{"partial"}}
+	fallback := &scriptedProvider{name: "fallback"}
+	r := NewResilientProvider([]NamedProvider{{"primary", primary}, {"fallback", fallback}},
+		RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	var deltas []string
+	_, err := r.StreamCompletion(context.Background(), &CompletionRequest{}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if errorKindOf(err) != ErrorKindServer {
+		t.Fatalf("StreamCompletion() error = %v, want the server error", err)
+	}
+	if len(primary.models) != 1 || len(fallback.models) != 0 {
+		t.Errorf("calls = %d and %d, want 1 and 0", len(primary.models), len(fallback.models))
+	}
+	if len(deltas) != 1 {
+		t.Errorf("deltas = %q, want one", deltas)
+	}
+}
+
+func TestResilientProviderCancelledDuringBackoff(t *testing.T) {
+	primary := &scriptedProvider{name: "primary", errs: []error{providerErr(ErrorKindServer)}}
+	r := NewResilientProvider([]NamedProvider{{"primary", primary}}, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.GenerateCompletion(ctx, &CompletionRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GenerateCompletion() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/prompts"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+	"github.com/google/uuid"
+)
+
+// rewordedTextSchema is the structured output of the rewording step
+var rewordedTextSchema = &ResponseSchema{
+	Name: "problem_text_reworded",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"problemTextReworded": map[string]interface{}{"type": "string"},
+			"examples": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"input":  map[string]interface{}{"type": "object"},
+						"output": map[string]interface{}{},
+					},
+					"required":             []interface{}{"input", "output"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []interface{}{"problemTextReworded", "examples"},
+		"additionalProperties": false,
+	},
+}
+
+// rewordedExample is an example the model reports as present in the reworded text
+type rewordedExample struct {
+	Input  map[string]interface{} `json:"input"`
+	Output interface{}            `json:"output"`
+}
+
+// RewordProblemText rewrites the problem text as a story with the same meaning and stores it
+// as the reworded text. The result must keep the function signature and must still contain
+// every sample case with its expected output.
+func (s *ProblemService) RewordProblemText(ctx context.Context, problemID uuid.UUID, model string) (string, error) {
+	ctx = withUsageStep(ctx, problemID, StepRewordProblemText)
+
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get problem: %w", err)
+	}
+	if problem.ProblemText == "" {
+		return "", fmt.Errorf("%w: problem has no problem text", ErrMissingArtifacts)
+	}
+	schema, err := signature.FromMap(problem.FunctionSignatureSchema)
+	if err != nil {
+		return "", err
+	}
+
+	var sampleCases []models.TestCase
+	for _, tc := range problem.TestCases {
+		if tc.IsSampleCase && tc.Input != nil && tc.HasExpected {
+			sampleCases = append(sampleCases, tc)
+		}
+	}
+
+	prompt, err := s.renderPrompt(ctx, prompts.RewordProblemText, problem, map[string]interface{}{
+		"SampleCases": sampleCases,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		ProblemTextReworded string            `json:"problemTextReworded"`
+		Examples            []rewordedExample `json:"examples"`
+	}
+	validate := func() error {
+		return checkRewordedText(result.ProblemTextReworded, result.Examples, problem.FunctionSignature, schema, sampleCases)
+	}
+	if err := s.aiService.GenerateObject(ctx, UserPrompt(model, prompt), rewordedTextSchema, &result, validate); err != nil {
+		return "", fmt.Errorf("failed to reword problem text: %w", err)
+	}
+
+	updates := map[string]interface{}{
+		"problemTextReworded": result.ProblemTextReworded,
+	}
+	if err := s.problemRepo.Update(ctx, problemID, updates); err != nil {
+		return "", fmt.Errorf("failed to update problem with reworded text: %w", err)
+	}
+	return result.ProblemTextReworded, nil
+}
+
+// checkRewordedText verifies that a reworded problem kept the signature and sample cases.
+// The text itself must contain the full signature and each sample case's values; the
+// examples the model lists must also match the sample cases.
+func checkRewordedText(text string, examples []rewordedExample, functionSignature string, schema *signature.FunctionSignatureSchema, sampleCases []models.TestCase) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("problemTextReworded must not be empty")
+	}
+	if !strings.Contains(collapseSpace(text), collapseSpace(functionSignature)) {
+		return fmt.Errorf("the reworded text must keep the function signature %q", functionSignature)
+	}
+
+	for i, ex := range examples {
+		if err := schema.ValidateArgs(ex.Input); err != nil {
+			return fmt.Errorf("example %d input does not match the function signature: %w", i+1, err)
+		}
+	}
+
+	compact := removeSpace(text)
+	for _, tc := range sampleCases {
+		for _, p := range schema.Parameters {
+			value, ok := tc.Input[p.Name]
+			if ok && !containsValue(compact, value) {
+				return fmt.Errorf("sample case %q: %s = %s does not appear in the reworded text", tc.Description, p.Name, renderJSON(value))
+			}
+		}
+		if !containsValue(compact, tc.Expected) {
+			return fmt.Errorf("sample case %q: output %s does not appear in the reworded text", tc.Description, renderJSON(tc.Expected))
+		}
+
+		found := false
+		for _, ex := range examples {
+			if reflect.DeepEqual(ex.Input, tc.Input) && reflect.DeepEqual(ex.Output, tc.Expected) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("sample case %q is missing from the examples or its values changed", tc.Description)
+		}
+	}
+	return nil
+}
+
+// containsValue reports whether text, with its whitespace removed, contains a decoded JSON
+// value written as JSON or as a Python literal. Strings may also appear unquoted.
+func containsValue(compact string, value interface{}) bool {
+	candidates := []string{renderJSON(value), renderPython(value)}
+	if str, ok := value.(string); ok {
+		candidates = append(candidates, str)
+	}
+	for _, candidate := range candidates {
+		if strings.Contains(compact, removeSpace(candidate)) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderJSON encodes a value as JSON without escaping HTML characters
+func renderJSON(value interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// renderPython writes a decoded JSON value as a Python literal
+func renderPython(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "\\'") + "'"
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = renderPython(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]string, len(keys))
+		for i, key := range keys {
+			items[i] = renderPython(key) + ": " + renderPython(v[key])
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	default:
+		return renderJSON(v)
+	}
+}
+
+// collapseSpace replaces each run of whitespace with a single space
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// removeSpace drops all whitespace
+func removeSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
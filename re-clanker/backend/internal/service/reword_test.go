@@ -0,0 +1,115 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+)
+
+func TestCheckRewordedText(t *testing.T) {
+	schema, err := signature.Parse([]byte(`{"version": 1, "functionName": "two_sum", "parameters": [
+			{"name": "nums", "type": {"kind": "array", "items": {"kind": "primitive", "type": "int"}}},
+			{"name": "target", "type": {"kind": "primitive", "type": "int"}}
+		], "returnType": {"kind": "array", "items": {"kind": "primitive", "type": "int"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	functionSignature := "def two_sum(nums: list[int], target: int) -> list[int]:"
+	sampleCases := []models.TestCase{{
+		Description: "basic",
+		Input:       map[string]interface{}{"nums": []interface{}{2.0, 7.0, 11.0}, "target": 9.0},
+		Expected:    []interface{}{0.0, 1.0},
+		HasExpected: true,
+	}}
+	examples := []rewordedExample{{Input: sampleCases[0].Input, Output: sampleCases[0].Expected}}
+
+	tests := []struct {
+		name     string
+		text     string
+		examples []rewordedExample
+		// wantErr is a substring of the expected error, or empty if the text passes
+		wantErr string
+	}{
+		{
+			"kept signature and values",
+			"Implement `def two_sum(nums: list[int], target: int) -> list[int]:`\n\nInput: nums = [2, 7, 11], target = 9\nOutput: [0, 1]",
+			examples, "",
+		},
+		{
+			"values written as JSON without spaces",
+			"def two_sum(nums: list[int],\n    target: int) -> list[int]:\n\nnums=[2,7,11] target=9 gives [0,1]",
+			examples, "",
+		},
+		{"empty", "  ", examples, "must not be empty"},
+		{
+			"only the function name",
+			"Implement two_sum(nums, target).\n\nInput: nums = [2, 7, 11], target = 9\nOutput: [0, 1]",
+			examples, "must keep the function signature",
+		},
+		{
+			"changed signature",
+			"def two_sum(nums: list[int], goal: int) -> list[int]:\n\nInput: nums = [2, 7, 11], goal = 9\nOutput: [0, 1]",
+			examples, "must keep the function signature",
+		},
+		{
+			"dropped sample input",
+			"def two_sum(nums: list[int], target: int) -> list[int]:\n\nInput: nums = [3, 5], target = 9\nOutput: [0, 1]",
+			examples, "nums = [2,7,11] does not appear",
+		},
+		{
+			"altered sample output",
+			"def two_sum(nums: list[int], target: int) -> list[int]:\n\nInput: nums = [2, 7, 11], target = 9\nOutput: [1, 2]",
+			examples, "output [0,1] does not appear",
+		},
+		{
+			"sample missing from the listed examples",
+			"def two_sum(nums: list[int], target: int) -> list[int]:\n\nInput: nums = [2, 7, 11], target = 9\nOutput: [0, 1]",
+			nil, "missing from the examples",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRewordedText(tt.text, tt.examples, functionSignature, schema, sampleCases)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkRewordedText() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("checkRewordedText() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContainsValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		value interface{}
+		want  bool
+	}{
+		{"JSON list", "nums = [1, 2]", []interface{}{1.0, 2.0}, true},
+		{"Python booleans", "flags = [True, False]", []interface{}{true, false}, true},
+		{"JSON booleans", "flags = [true, false]", []interface{}{true, false}, true},
+		{"Python None", "returns None", nil, true},
+		{"JSON null", "returns null", nil, true},
+		{"quoted string", `s = "a<b"`, "a<b", true},
+		{"Python string", "s = 'abc'", "abc", true},
+		{"unquoted string", "the word is hello", "hello", true},
+		{"Python dict", "counts = {'a': 1, 'b': 2}", map[string]interface{}{"a": 1.0, "b": 2.0}, true},
+		{"float", "answer: 2.5", 2.5, true},
+		{"different list", "nums = [1, 3]", []interface{}{1.0, 2.0}, false},
+		{"missing number", "answer: 41", 42.0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containsValue(removeSpace(tt.text), tt.value); got != tt.want {
+				t.Errorf("containsValue(%q, %v) = %v, want %v", tt.text, tt.value, got, tt.want)
+			}
+		})
+	}
+}
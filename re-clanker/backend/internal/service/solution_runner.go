@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/executor"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/runner"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+)
+
+// solutionProgram is a solution ready to run on inputs
+type solutionProgram struct {
+	runner *runner.Runner
+	schema *signature.FunctionSignatureSchema
+	files  map[string]string
+	// buildError is set when a compiled solution failed to build; every run reports it
+	buildError string
+}
+
+// solutionRun is the outcome of calling a solution on one input
+type solutionRun struct {
+	Output interface{}
+	Stdout string
+	// Error is set when the solution crashed, timed out or returned a malformed value
+	Error string
+}
+
+// prepareSolution writes code and the harness of its language for the schema's function,
+// and builds them if the language is compiled. The build runs in the executor like the
+// solution itself; a build that fails is reported by every run of the program.
+func (s *ProblemService) prepareSolution(ctx context.Context, language, code string, schema *signature.FunctionSignatureSchema) (*solutionProgram, error) {
+	r, err := s.runners.Runnable(language)
+	if err != nil {
+		return nil, err
+	}
+	files, err := r.Files(code, schema)
+	if err != nil {
+		return nil, err
+	}
+	program := &solutionProgram{runner: r, schema: schema, files: files}
+	if !r.Compiled() {
+		return program, nil
+	}
+
+	result, err := s.executor.Run(ctx, executor.Request{
+		Command: r.Build,
+		Files:   files,
+		Env:     r.BuildEnv,
+		Timeout: r.BuildTimeout,
+		Collect: []string{r.Program},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build %s solution: %w", r.Name, err)
+	}
+	binary, ok := result.Files[r.Program]
+	switch {
+	case result.TimedOut:
+		program.buildError = "build timed out"
+		return program, nil
+	case result.Failure() != "" || !ok:
+		program.buildError = fmt.Sprintf("failed to compile: %s", truncate(result.Stderr, 2000))
+		return program, nil
+	}
+	// The program runs without the sources or the build cache
+	program.files = map[string]string{r.Program: binary}
+	return program, nil
+}
+
+// runSolution calls the program's function with the given input
+func (s *ProblemService) runSolution(ctx context.Context, program *solutionProgram, input map[string]interface{}) (*solutionRun, error) {
+	if program.buildError != "" {
+		return &solutionRun{Error: program.buildError}, nil
+	}
+	schema := program.schema
+	args, err := positionalArgs(schema, input)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input: %w", err)
+	}
+
+	result, err := s.executor.Run(ctx, executor.Request{
+		Command: program.runner.Command(),
+		Files:   program.files,
+		Stdin:   stdin,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, encoded, found := splitResult(result.Stdout)
+	run := &solutionRun{Stdout: stdout}
+	switch {
+	case result.TimedOut:
+		run.Error = "timed out"
+	case result.Failure() != "":
+		run.Error = fmt.Sprintf("%s: %s", result.Failure(), truncate(result.Stderr, 2000))
+	case !found:
+		run.Error = "solution produced no result"
+	default:
+		if err := json.Unmarshal([]byte(encoded), &run.Output); err != nil {
+			run.Error = fmt.Sprintf("failed to decode result: %v", err)
+		} else if err := schema.ValidateValue(schema.ReturnType, run.Output); err != nil {
+			run.Error = fmt.Sprintf("return value does not match the function signature: %v", err)
+		}
+	}
+	return run, nil
+}
+
+// positionalArgs orders a named input by the schema's parameters.
+// Trailing optional parameters that are absent are left out.
+func positionalArgs(schema *signature.FunctionSignatureSchema, input map[string]interface{}) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(schema.Parameters))
+	missing := 0
+	for _, p := range schema.Parameters {
+		value, ok := input[p.Name]
+		if !ok {
+			if !p.Optional {
+				return nil, fmt.Errorf("missing argument %q", p.Name)
+			}
+			missing++
+			continue
+		}
+		if missing > 0 {
+			return nil, fmt.Errorf("argument %q follows an omitted optional argument", p.Name)
+		}
+		args = append(args, value)
+	}
+	return args, nil
+}
+
+// splitResult separates the harness result line from the program's own output
+func splitResult(stdout string) (userStdout, result string, found bool) {
+	i := strings.LastIndex(stdout, runner.ResultMarker)
+	if i == -1 {
+		return stdout, "", false
+	}
+	userStdout = strings.TrimSuffix(stdout[:i], "\n")
+	result = strings.TrimSpace(stdout[i+len(runner.ResultMarker):])
+	return userStdout, result, true
+}
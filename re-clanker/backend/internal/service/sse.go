@@ -0,0 +1,57 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errStreamDone is returned by an SSE handler to stop reading at an end-of-stream marker
+var errStreamDone = errors.New("stream done")
+
+// maxSSELine bounds a single line of a server-sent event stream
+const maxSSELine = 1 << 20
+
+// readSSE reads a server-sent event stream and calls onData with the data of each event.
+// Comments and other fields are ignored. Reading stops at the end of the body or when
+// onData returns errStreamDone.
+func readSSE(body io.Reader, onData func(data string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELine)
+
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			return nil
+		}
+		event := strings.Join(data, "\n")
+		data = data[:0]
+		return onData(event)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if err := dispatch(); err != nil {
+				return ignoreStreamDone(err)
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return ignoreStreamDone(dispatch())
+}
+
+func ignoreStreamDone(err error) error {
+	if errors.Is(err, errStreamDone) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSSE(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []string
+	}{
+		{"single event", "data: hello\n\n", []string{"hello"}},
+		{"several events", "data: a\n\ndata: b\n\n", []string{"a", "b"}},
+		{"multi-line data", "data: a\ndata: b\n\n", []string{"a\nb"}},
+		{"no space after colon", "data:a\n\n", []string{"a"}},
+		{"only the first space is dropped", "data:  a\n\n", []string{" a"}},
+		{"comments and other fields", ": keepalive\nevent: message\nid: 1\ndata: a\n\n", []string{"a"}},
+		{"blank lines between events", "\n\ndata: a\n\n\n", []string{"a"}},
+		{"last event without blank line", "data: a\n\ndata: b", []string{"a", "b"}},
+		{"CRLF line endings", "data: a\r\n\r\ndata: b\r\n\r\n", []string{"a", "b"}},
+		{"end-of-stream marker", "data: a\n\ndata: [DONE]\n\ndata: b\n\n", []string{"a"}},
+		{"empty stream", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := readSSE(strings.NewReader(tt.stream), func(data string) error {
+				if data == "[DONE]" {
+					return errStreamDone
+				}
+				got = append(got, data)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("readSSE() = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSSEErrors(t *testing.T) {
+	handlerErr := errors.New("handler failed")
+	err := readSSE(strings.NewReader("data: a\n\ndata: b\n\n"), func(string) error { return handlerErr })
+	if !errors.Is(err, handlerErr) {
+		t.Errorf("readSSE() = %v, want the handler's error", err)
+	}
+
+	long := "data: " + strings.Repeat("x", maxSSELine) + "\n\n"
+	err = readSSE(strings.NewReader(long), func(string) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "failed to read stream") {
+		t.Errorf("readSSE() with an overlong line = %v, want a read error", err)
+	}
+}
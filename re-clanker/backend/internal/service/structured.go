@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// maxStructuredAttempts bounds how often a malformed structured response is retried
+const maxStructuredAttempts = 3
+
+// GenerateObject completes req with a value conforming to schema and decodes it into out,
+// which must be a pointer. The provider's native structured output is used where available;
+// otherwise the schema is spelled out in the last user message. The result is checked
+// against the schema and, if given, by validate (called after out is populated). Malformed
+// results are retried by replying to the model with the validation error.
+func (s *AIService) GenerateObject(ctx context.Context, req *CompletionRequest, schema *ResponseSchema, out interface{}, validate func() error) error {
+	target := reflect.ValueOf(out)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("GenerateObject requires a non-nil pointer, got %T", out)
+	}
+
+	native := true
+	attempt := *req
+	attempt.ResponseSchema = schema
+	var lastErr error
+	for i := 1; i <= maxStructuredAttempts; i++ {
+		var resp *CompletionResponse
+		var err error
+		if native {
+			resp, err = s.Complete(ctx, &attempt)
+			if errors.Is(err, ErrStructuredOutputUnsupported) {
+				native = false
+			}
+		}
+		if !native {
+			resp, err = s.Complete(ctx, attempt.withSchemaInstructions())
+		}
+		if err != nil {
+			return err
+		}
+
+		lastErr = decodeStructured(resp.Text, schema, target, validate)
+		if lastErr == nil {
+			return nil
+		}
+		attempt = *attempt.withFollowUp(
+			Message{Role: RoleAssistant, Content: truncate(resp.Text, 4000)},
+			Message{Role: RoleUser, Content: fmt.Sprintf("Your previous response was rejected.\n\nError: %v\n\nRespond again with corrected JSON.", lastErr)},
+		)
+	}
+	return fmt.Errorf("invalid structured output after %d attempts: %w", maxStructuredAttempts, lastErr)
+}
+
+// StreamObject is GenerateObject for a streamed completion: the raw response is passed to
+// onDelta as it is produced. Streamed output cannot be taken back, so a malformed response
+// fails instead of being retried.
+func (s *AIService) StreamObject(ctx context.Context, req *CompletionRequest, schema *ResponseSchema, out interface{}, validate func() error, onDelta func(delta string) error) error {
+	target := reflect.ValueOf(out)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("StreamObject requires a non-nil pointer, got %T", out)
+	}
+
+	attempt := *req
+	attempt.ResponseSchema = schema
+	resp, err := s.Stream(ctx, &attempt, onDelta)
+	if errors.Is(err, ErrStructuredOutputUnsupported) {
+		resp, err = s.Stream(ctx, attempt.withSchemaInstructions(), onDelta)
+	}
+	if err != nil {
+		return err
+	}
+	return decodeStructured(resp.Text, schema, target, validate)
+}
+
+// decodeStructured parses a structured response, validates it and stores it in target
+func decodeStructured(text string, schema *ResponseSchema, target reflect.Value, validate func() error) error {
+	raw := []byte(extractJSON(text))
+
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	if err := validateJSONSchema(schema.Schema, generic); err != nil {
+		return fmt.Errorf("response does not match the schema: %w", err)
+	}
+
+	// Decode into a fresh value so a rejected attempt leaves nothing behind
+	fresh := reflect.New(target.Elem().Type())
+	if err := json.Unmarshal(raw, fresh.Interface()); err != nil {
+		return fmt.Errorf("response does not match the expected structure: %w", err)
+	}
+	target.Elem().Set(fresh.Elem())
+
+	if validate != nil {
+		return validate()
+	}
+	return nil
+}
+
+// withSchemaInstructions appends the schema to a prompt for providers without native support
+func withSchemaInstructions(prompt string, schema *ResponseSchema) string {
+	schemaJSON, _ := json.MarshalIndent(schema.Schema, "", "  ")
+	return fmt.Sprintf("%s\n\nRespond with a single JSON value only, with no surrounding prose, that conforms to this JSON schema:\n%s",
+		prompt, schemaJSON)
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/runner"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultLanguage is the language of submissions that do not name one
+const DefaultLanguage = runner.Python
+
+// Errors returned by RunSubmission, RunCustomInputs and StarterCode
+var (
+	ErrUnsupportedLanguage = runner.ErrUnsupportedLanguage
+	ErrUnsupportedRuntime  = runner.ErrUnsupportedRuntime
+	ErrInvalidInput        = errors.New("invalid custom input")
+)
+
+// MaxCustomInputs limits how many custom inputs a single run may take
+const MaxCustomInputs = 20
+
+// Test result statuses
+const (
+	TestStatusPass = "pass"
+	TestStatusFail = "fail"
+	// TestStatusError means the submission crashed, timed out or returned a malformed value
+	TestStatusError = "error"
+	// TestStatusSkipped means the reference solution failed on the case, so it has no
+	// expected output to grade against
+	TestStatusSkipped = "skipped"
+)
+
+// TestResult is the outcome of running a submission on one test case
+type TestResult struct {
+	TestCase models.TestCase `json:"testCase"`
+	Status   string          `json:"status"`
+	Actual   interface{}     `json:"actual"`
+	Expected interface{}     `json:"expected"`
+	Error    string          `json:"error,omitempty"`
+	Stdout   string          `json:"stdout,omitempty"`
+}
+
+// SubmissionResult is the outcome of running a submission on all of a problem's test cases
+type SubmissionResult struct {
+	Results []TestResult `json:"results"`
+	Passed  int          `json:"passed"`
+	// Total counts the graded test cases, leaving out skipped ones
+	Total int `json:"total"`
+}
+
+// RunSubmission runs code against every test case of a problem and grades each result
+// against the expected output. Nothing is stored.
+func (s *ProblemService) RunSubmission(ctx context.Context, problemID uuid.UUID, code, language string) (*SubmissionResult, error) {
+	if language == "" {
+		language = DefaultLanguage
+	}
+	if _, err := s.runners.Runnable(language); err != nil {
+		return nil, err
+	}
+
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range []GenerationStep{StepParseFunctionSignature, StepGenerateTestCaseInputs, StepGenerateTestCaseOutputs} {
+		if err := checkStepArtifacts(step, problem); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMissingArtifacts, err)
+		}
+	}
+	if len(problem.TestCases) == 0 {
+		return nil, fmt.Errorf("%w: problem has no test cases", ErrMissingArtifacts)
+	}
+	schema, err := signature.FromMap(problem.FunctionSignatureSchema)
+	if err != nil {
+		return nil, err
+	}
+	program, err := s.prepareSolution(ctx, language, code, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]TestResult, len(problem.TestCases))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxParallelRuns)
+	for i, tc := range problem.TestCases {
+		g.Go(func() error {
+			result := TestResult{TestCase: tc, Expected: tc.Expected}
+			if tc.ExpectedError != nil {
+				result.Status = TestStatusSkipped
+				result.Error = "reference solution failed on this test case: " + *tc.ExpectedError
+				results[i] = result
+				return nil
+			}
+
+			run, err := s.runSolution(gctx, program, tc.Input)
+			if err != nil {
+				return fmt.Errorf("test case %d (%s): %w", i+1, tc.Description, err)
+			}
+			result.Stdout = run.Stdout
+			switch {
+			case run.Error != "":
+				result.Status = TestStatusError
+				result.Error = run.Error
+			case outputsEqual(schema, tc.Expected, run.Output):
+				result.Status = TestStatusPass
+				result.Actual = run.Output
+			default:
+				result.Status = TestStatusFail
+				result.Actual = run.Output
+			}
+			results[i] = result
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	submission := &SubmissionResult{Results: results}
+	for _, result := range results {
+		if result.Status == TestStatusSkipped {
+			continue
+		}
+		submission.Total++
+		if result.Status == TestStatusPass {
+			submission.Passed++
+		}
+	}
+	return submission, nil
+}
+
+// CustomTestResult compares a submission with the reference solution on one custom input
+type CustomTestResult struct {
+	// Input is the input keyed by parameter name, however it was given
+	Input    map[string]interface{} `json:"input"`
+	Expected interface{}            `json:"expected"`
+	Actual   interface{}            `json:"actual"`
+	// Matches is true when both solutions succeeded and returned the same value
+	Matches bool `json:"matches"`
+	// ExpectedError is set when the reference solution failed on the input
+	ExpectedError string `json:"expectedError,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Stdout        string `json:"stdout,omitempty"`
+}
+
+// RunCustomInputs runs code and the problem's reference solution on inputs given by the
+// user, which are either positional argument lists or objects keyed by parameter name.
+// Inputs are checked against the function signature before anything runs, and nothing is
+// stored.
+func (s *ProblemService) RunCustomInputs(ctx context.Context, problemID uuid.UUID, code, language string, inputs []interface{}) ([]CustomTestResult, error) {
+	if language == "" {
+		language = DefaultLanguage
+	}
+	if _, err := s.runners.Runnable(language); err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("%w: no inputs given", ErrInvalidInput)
+	}
+	if len(inputs) > MaxCustomInputs {
+		return nil, fmt.Errorf("%w: at most %d inputs may be run at once", ErrInvalidInput, MaxCustomInputs)
+	}
+
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range []GenerationStep{StepParseFunctionSignature, StepGenerateSolution} {
+		if err := checkStepArtifacts(step, problem); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMissingArtifacts, err)
+		}
+	}
+	schema, err := signature.FromMap(problem.FunctionSignatureSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]CustomTestResult, len(inputs))
+	for i, input := range inputs {
+		named, err := namedArgs(schema, input)
+		if err == nil {
+			err = schema.ValidateArgs(named)
+		}
+		if err == nil {
+			_, err = positionalArgs(schema, named)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w %d: %v", ErrInvalidInput, i+1, err)
+		}
+		results[i].Input = named
+	}
+
+	reference, err := s.prepareSolution(ctx, problem.SolutionLanguage, *problem.Solution, schema)
+	if err != nil {
+		return nil, err
+	}
+	submission, err := s.prepareSolution(ctx, language, code, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	// Both solutions run on every input, so each input takes two slots
+	expected := make([]*solutionRun, len(inputs))
+	actual := make([]*solutionRun, len(inputs))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxParallelRuns)
+	for i := range results {
+		for _, side := range []struct {
+			program *solutionProgram
+			runs    []*solutionRun
+		}{{reference, expected}, {submission, actual}} {
+			g.Go(func() error {
+				run, err := s.runSolution(gctx, side.program, results[i].Input)
+				if err != nil {
+					return fmt.Errorf("custom input %d: %w", i+1, err)
+				}
+				side.runs[i] = run
+				return nil
+			})
+		}
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		result := &results[i]
+		result.Expected = expected[i].Output
+		result.ExpectedError = expected[i].Error
+		result.Actual = actual[i].Output
+		result.Error = actual[i].Error
+		result.Stdout = actual[i].Stdout
+		result.Matches = expected[i].Error == "" && actual[i].Error == "" &&
+			outputsEqual(schema, expected[i].Output, actual[i].Output)
+	}
+	return results, nil
+}
+
+// floatTolerance is how far apart, relative to their size, two float values may be and
+// still be taken as the same output. Float results often differ in the last digits between
+// languages.
+const floatTolerance = 1e-9
+
+// outputsEqual compares two decoded JSON values of the schema's return type. Values declared
+// as float match within floatTolerance; everything else, integers included, must be equal.
+func outputsEqual(schema *signature.FunctionSignatureSchema, a, b interface{}) bool {
+	return valuesEqual(schema, schema.ReturnType, a, b, nil)
+}
+
+// valuesEqual compares a and b as values of t. resolving holds the named types resolved since
+// the last container, so a reference cycle cannot recurse forever.
+func valuesEqual(schema *signature.FunctionSignatureSchema, t *signature.TypeDef, a, b interface{}, resolving map[string]bool) bool {
+	if t == nil {
+		return reflect.DeepEqual(a, b)
+	}
+
+	switch t.Kind {
+	case signature.KindPrimitive:
+		x, okA := a.(float64)
+		y, okB := b.(float64)
+		if t.Primitive == signature.PrimitiveFloat && okA && okB {
+			return x == y || math.Abs(x-y) <= floatTolerance*max(1, math.Abs(x), math.Abs(y))
+		}
+		return reflect.DeepEqual(a, b)
+	case signature.KindArray, signature.KindTuple:
+		x, okA := a.([]interface{})
+		y, okB := b.([]interface{})
+		if !okA || !okB || len(x) != len(y) {
+			return reflect.DeepEqual(a, b)
+		}
+		for i := range x {
+			item := t.Items
+			if t.Kind == signature.KindTuple {
+				if i >= len(t.Elements) {
+					return reflect.DeepEqual(a, b)
+				}
+				item = t.Elements[i]
+			}
+			if !valuesEqual(schema, item, x[i], y[i], nil) {
+				return false
+			}
+		}
+		return true
+	case signature.KindObject, signature.KindMap:
+		x, okA := a.(map[string]interface{})
+		y, okB := b.(map[string]interface{})
+		if !okA || !okB || len(x) != len(y) {
+			return reflect.DeepEqual(a, b)
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok {
+				return false
+			}
+			field := t.ValueType
+			if t.Kind == signature.KindObject {
+				field = t.Properties[key]
+			}
+			if !valuesEqual(schema, field, value, other, nil) {
+				return false
+			}
+		}
+		return true
+	case signature.KindUnion:
+		// Compare as each alternative the expected value belongs to
+		for _, alt := range t.Types {
+			if schema.ValidateValue(alt, a) == nil && valuesEqual(schema, alt, a, b, resolving) {
+				return true
+			}
+		}
+		return reflect.DeepEqual(a, b)
+	case signature.KindReference:
+		nt := schema.NamedType(t.Name)
+		if nt == nil || resolving[t.Name] {
+			return reflect.DeepEqual(a, b)
+		}
+		next := map[string]bool{t.Name: true}
+		for name := range resolving {
+			next[name] = true
+		}
+		return valuesEqual(schema, nt.Definition, a, b, next)
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// namedArgs keys an input by parameter name. A list is taken as positional arguments, of
+// which trailing optional ones may be left out.
+func namedArgs(schema *signature.FunctionSignatureSchema, input interface{}) (map[string]interface{}, error) {
+	switch v := input.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case []interface{}:
+		required := 0
+		for _, p := range schema.Parameters {
+			if !p.Optional {
+				required++
+			}
+		}
+		if len(v) < required || len(v) > len(schema.Parameters) {
+			if required == len(schema.Parameters) {
+				return nil, fmt.Errorf("got %d arguments, the function takes %d", len(v), required)
+			}
+			return nil, fmt.Errorf("got %d arguments, the function takes %d to %d", len(v), required, len(schema.Parameters))
+		}
+		named := make(map[string]interface{}, len(v))
+		for i, value := range v {
+			named[schema.Parameters[i].Name] = value
+		}
+		return named, nil
+	default:
+		return nil, fmt.Errorf("must be a list of arguments or an object keyed by parameter name")
+	}
+}
+
+// StarterCode generates stub code for a problem's function in the given language
+func (s *ProblemService) StarterCode(ctx context.Context, problemID uuid.UUID, language string) (string, error) {
+	if language == "" {
+		language = DefaultLanguage
+	}
+	r, err := s.runners.Get(language)
+	if err != nil {
+		return "", err
+	}
+
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return "", err
+	}
+	if err := checkStepArtifacts(StepParseFunctionSignature, problem); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMissingArtifacts, err)
+	}
+	schema, err := signature.FromMap(problem.FunctionSignatureSchema)
+	if err != nil {
+		return "", err
+	}
+	return r.StarterCode(schema), nil
+}
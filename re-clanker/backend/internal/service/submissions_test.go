@@ -0,0 +1,130 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+)
+
+func TestOutputsEqual(t *testing.T) {
+	const (
+		intType    = `{"kind": "primitive", "type": "int"}`
+		floatType  = `{"kind": "primitive", "type": "float"}`
+		stringType = `{"kind": "primitive", "type": "string"}`
+	)
+	tests := []struct {
+		name       string
+		returnType string
+		a, b       string
+		want       bool
+	}{
+		{"equal ints", intType, `3`, `3`, true},
+		{"different ints", intType, `3`, `4`, false},
+		{"modular answers", intType, `1000000007`, `1000000008`, false},
+		{"large counts", intType, `1000000000000`, `1000000000999`, false},
+		{"ints are not given a tolerance", intType, `5000000000`, `5000000005`, false},
+		{"float rounding difference", floatType, `0.30000000000000004`, `0.3`, true},
+		{"float relative to large numbers", floatType, `1e12`, `1000000000000.0001`, true},
+		{"float beyond tolerance", floatType, `0.1`, `0.1001`, false},
+		{"small floats use an absolute tolerance", floatType, `1e-12`, `0`, true},
+		{"float and int", floatType, `3`, `3.0`, true},
+		{"number and string", floatType, `1`, `"1"`, false},
+		{"strings", stringType, `"a"`, `"a"`, true},
+		{
+			"list of ints",
+			`{"kind": "array", "items": ` + intType + `}`,
+			`[1000000007, 2]`, `[1000000008, 2]`, false,
+		},
+		{
+			"nested lists of floats",
+			`{"kind": "array", "items": {"kind": "array", "items": ` + floatType + `}}`,
+			`[[0.1, 0.2], [0.30000000000000004]]`, `[[0.1, 0.2], [0.3]]`, true,
+		},
+		{
+			"lists of different length",
+			`{"kind": "array", "items": ` + floatType + `}`,
+			`[1, 2]`, `[1, 2, 3]`, false,
+		},
+		{
+			"tuple of int and float",
+			`{"kind": "tuple", "items": [` + intType + `, ` + floatType + `]}`,
+			`[7, 0.30000000000000004]`, `[7, 0.3]`, true,
+		},
+		{
+			"tuple with a different int",
+			`{"kind": "tuple", "items": [` + intType + `, ` + floatType + `]}`,
+			`[7, 0.3]`, `[8, 0.3]`, false,
+		},
+		{
+			"object",
+			`{"kind": "object", "properties": {"x": ` + floatType + `, "n": ` + intType + `}}`,
+			`{"x": 0.30000000000000004, "n": 1}`, `{"n": 1, "x": 0.3}`, true,
+		},
+		{
+			"object with different keys",
+			`{"kind": "object", "properties": {"x": ` + intType + `}}`,
+			`{"x": 1}`, `{"y": 1}`, false,
+		},
+		{
+			"map of floats",
+			`{"kind": "map", "keyType": ` + stringType + `, "valueType": ` + floatType + `}`,
+			`{"a": 0.30000000000000004}`, `{"a": 0.3}`, true,
+		},
+		{
+			"map of ints",
+			`{"kind": "map", "keyType": ` + stringType + `, "valueType": ` + intType + `}`,
+			`{"a": 1000000007}`, `{"a": 1000000008}`, false,
+		},
+		{"nullable int", `{"kind": "union", "types": [` + intType + `, {"kind": "primitive", "type": "null"}]}`, `null`, `null`, true},
+		{"nullable int against a number", `{"kind": "union", "types": [` + intType + `, {"kind": "primitive", "type": "null"}]}`, `null`, `0`, false},
+		{"union allowing floats", `{"kind": "union", "types": [` + intType + `, ` + floatType + `]}`, `3`, `3.0000000000001`, true},
+		{"named type", `{"kind": "reference", "name": "Point"}`, `{"x": 1, "y": 2}`, `{"x": 1, "y": 3}`, false},
+		{"list and object", `{"kind": "array", "items": ` + intType + `}`, `[]`, `{}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := &signature.FunctionSignatureSchema{
+				ReturnType: mustTypeDef(t, tt.returnType),
+				NamedTypes: []signature.NamedType{{
+					Name:       "Point",
+					Definition: mustTypeDef(t, `{"kind": "object", "properties": {"x": `+intType+`, "y": `+intType+`}}`),
+				}},
+			}
+			var a, b interface{}
+			if err := json.Unmarshal([]byte(tt.a), &a); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.b), &b); err != nil {
+				t.Fatal(err)
+			}
+			if got := outputsEqual(schema, a, b); got != tt.want {
+				t.Errorf("outputsEqual(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// A schema that was never validated may hold a reference cycle, which must not recurse forever
+func TestOutputsEqualReferenceCycle(t *testing.T) {
+	schema := &signature.FunctionSignatureSchema{
+		ReturnType: mustTypeDef(t, `{"kind": "reference", "name": "A"}`),
+		NamedTypes: []signature.NamedType{
+			{Name: "A", Definition: mustTypeDef(t, `{"kind": "reference", "name": "B"}`)},
+			{Name: "B", Definition: mustTypeDef(t, `{"kind": "reference", "name": "A"}`)},
+		},
+	}
+	if !outputsEqual(schema, 1.0, 1.0) || outputsEqual(schema, 1.0, 2.0) {
+		t.Error("outputsEqual() on a reference cycle did not fall back to exact comparison")
+	}
+}
+
+func mustTypeDef(t *testing.T, data string) *signature.TypeDef {
+	t.Helper()
+	var typ signature.TypeDef
+	if err := json.Unmarshal([]byte(data), &typ); err != nil {
+		t.Fatal(err)
+	}
+	return &typ
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/executor"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/runner"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxParallelRuns bounds how many sandboxed programs a single step runs at once
+const maxParallelRuns = 4
+
+// inputCodeLanguage is the language the generate_test_case_input_code prompt asks for
+const inputCodeLanguage = runner.Python
+
+// GenerateTestCaseInputs runs each test case's input code in the executor and stores
+// the JSON it prints as the test case input, after checking it against the signature schema
+func (s *ProblemService) GenerateTestCaseInputs(ctx context.Context, problemID uuid.UUID) error {
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return fmt.Errorf("failed to get problem: %w", err)
+	}
+	if len(problem.TestCases) == 0 {
+		return fmt.Errorf("problem has no test cases")
+	}
+	schema, err := signature.FromMap(problem.FunctionSignatureSchema)
+	if err != nil {
+		return err
+	}
+
+	inputs := make([]map[string]interface{}, len(problem.TestCases))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxParallelRuns)
+	for i, tc := range problem.TestCases {
+		g.Go(func() error {
+			input, err := s.runInputCode(gctx, schema, tc)
+			if err != nil {
+				return fmt.Errorf("test case %d (%s): %w", i+1, tc.Description, err)
+			}
+			inputs[i] = input
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	for i, tc := range problem.TestCases {
+		if err := s.problemRepo.UpdateTestCaseInput(ctx, tc.ID, inputs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runInputCode executes one test case's input program and validates its output
+func (s *ProblemService) runInputCode(ctx context.Context, schema *signature.FunctionSignatureSchema, tc models.TestCase) (map[string]interface{}, error) {
+	if tc.InputCode == nil || *tc.InputCode == "" {
+		return nil, fmt.Errorf("no input code")
+	}
+
+	r, err := s.runners.Runnable(inputCodeLanguage)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.executor.Run(ctx, executor.Request{
+		Command: r.ScriptCommand("main.py"),
+		Files:   map[string]string{"main.py": *tc.InputCode},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if failure := result.Failure(); failure != "" {
+		return nil, fmt.Errorf("input code %s: %s", failure, truncate(result.Stderr, 500))
+	}
+
+	var input map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(result.Stdout)), &input); err != nil {
+		return nil, fmt.Errorf("input code did not print a JSON object: %w", err)
+	}
+	if err := schema.ValidateArgs(input); err != nil {
+		return nil, fmt.Errorf("input does not match the function signature: %w", err)
+	}
+	return input, nil
+}
+
+// truncate shortens s to at most n bytes for inclusion in error messages
+func truncate(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/signature"
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+// GenerateTestCaseOutputs runs the reference solution on every test case input and stores
+// the result as the expected output. Cases on which the solution crashes or times out are
+// flagged with an error instead; the step only fails if no case produced an output.
+func (s *ProblemService) GenerateTestCaseOutputs(ctx context.Context, problemID uuid.UUID) error {
+	problem, err := s.problemRepo.GetByID(ctx, problemID)
+	if err != nil {
+		return fmt.Errorf("failed to get problem: %w", err)
+	}
+	if problem.Solution == nil || *problem.Solution == "" {
+		return fmt.Errorf("problem has no solution")
+	}
+	if len(problem.TestCases) == 0 {
+		return fmt.Errorf("problem has no test cases")
+	}
+	schema, err := signature.FromMap(problem.FunctionSignatureSchema)
+	if err != nil {
+		return err
+	}
+
+	program, err := s.prepareSolution(ctx, problem.SolutionLanguage, *problem.Solution, schema)
+	if err != nil {
+		return err
+	}
+	if program.buildError != "" {
+		return fmt.Errorf("reference solution %s", program.buildError)
+	}
+
+	runs := make([]*solutionRun, len(problem.TestCases))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxParallelRuns)
+	for i, tc := range problem.TestCases {
+		g.Go(func() error {
+			if tc.Input == nil {
+				runs[i] = &solutionRun{Error: "test case has no input"}
+				return nil
+			}
+			run, err := s.runSolution(gctx, program, tc.Input)
+			if err != nil {
+				return fmt.Errorf("test case %d (%s): %w", i+1, tc.Description, err)
+			}
+			runs[i] = run
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	failed := 0
+	for i, tc := range problem.TestCases {
+		var expectedErr *string
+		if runs[i].Error != "" {
+			failed++
+			expectedErr = &runs[i].Error
+			log.Printf("Reference solution failed on test case %s of problem %s: %s", tc.ID, problemID, runs[i].Error)
+		}
+		if err := s.problemRepo.UpdateTestCaseExpected(ctx, tc.ID, runs[i].Output, expectedErr); err != nil {
+			return err
+		}
+	}
+	if failed == len(problem.TestCases) {
+		return fmt.Errorf("reference solution failed on every test case")
+	}
+	return nil
+}
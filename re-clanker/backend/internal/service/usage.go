@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// ModelPrice is the price of a model in US dollars per million tokens
+type ModelPrice struct {
+	PromptPerMillion     float64 `json:"promptPerMillion"`
+	CompletionPerMillion float64 `json:"completionPerMillion"`
+}
+
+// PriceTable maps model names, as sent to or reported by providers, to their prices
+type PriceTable map[string]ModelPrice
+
+// LoadPriceTable reads a JSON price table such as
+// {"anthropic/claude-3.5-sonnet": {"promptPerMillion": 3, "completionPerMillion": 15}}.
+// An empty path gives an empty table.
+func LoadPriceTable(path string) (PriceTable, error) {
+	if path == "" {
+		return PriceTable{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+	var table PriceTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse price table %s: %w", path, err)
+	}
+	return table, nil
+}
+
+// estimateCost prices a completion from the table, trying the model that served it and then
+// the model that was requested, and falls back to the cost the provider reported
+func (t PriceTable) estimateCost(requestedModel string, resp *CompletionResponse) *float64 {
+	for _, model := range []string{resp.Model, requestedModel} {
+		if price, ok := t[model]; ok && model != "" {
+			return price.cost(resp.Usage)
+		}
+	}
+	return resp.Usage.CostUSD
+}
+
+// cost prices the tokens of a completion
+func (p ModelPrice) cost(usage Usage) *float64 {
+	cost := (float64(usage.PromptTokens)*p.PromptPerMillion +
+		float64(usage.CompletionTokens)*p.CompletionPerMillion) / 1e6
+	return &cost
+}
+
+// usageScope is what AI calls made under a context are attributed to
+type usageScope struct {
+	JobID     *uuid.UUID
+	ProblemID *uuid.UUID
+	Step      *string
+}
+
+type usageScopeKey struct{}
+
+// withUsageJob attributes AI calls made under ctx to a generation job
+func withUsageJob(ctx context.Context, job *models.GenerationJob) context.Context {
+	scope := usageScopeFrom(ctx)
+	scope.JobID = &job.ID
+	scope.ProblemID = &job.ProblemID
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+// withUsageStep attributes AI calls made under ctx to a problem and pipeline step, keeping
+// any job already set
+func withUsageStep(ctx context.Context, problemID uuid.UUID, step GenerationStep) context.Context {
+	scope := usageScopeFrom(ctx)
+	name := string(step)
+	scope.ProblemID = &problemID
+	scope.Step = &name
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+func usageScopeFrom(ctx context.Context) usageScope {
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	return scope
+}
+
+// recordUsage stores the usage of a completed call. Failures are logged rather than
+// returned so accounting never fails generation.
+func (s *AIService) recordUsage(ctx context.Context, req *CompletionRequest, resp *CompletionResponse, latency time.Duration) {
+	if s.usageRepo == nil {
+		return
+	}
+	scope := usageScopeFrom(ctx)
+	usage := &models.AIUsage{
+		JobID:            scope.JobID,
+		ProblemID:        scope.ProblemID,
+		Step:             scope.Step,
+		Provider:         resp.Provider,
+		Model:            resp.Model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		LatencyMs:        int(latency.Milliseconds()),
+		CostUSD:          s.prices.estimateCost(req.Model, resp),
+	}
+	if req.catalog != nil {
+		usage.ModelID = &req.catalog.modelID
+		// Catalog prices only hold if the catalog's provider served the call, not a fallback
+		if req.catalog.price != nil && resp.Provider == req.catalog.provider {
+			usage.CostUSD = req.catalog.price.cost(resp.Usage)
+		}
+	}
+	if err := s.usageRepo.Create(context.WithoutCancel(ctx), usage, req.Model); err != nil {
+		log.Printf("Failed to record AI usage: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/models"
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Directions in which a variant of a problem can be generated
+const (
+	VariantEasier = "easier"
+	VariantHarder = "harder"
+)
+
+// ErrInvalidDirection is returned for a variant direction other than easier or harder
+var ErrInvalidDirection = errors.New("direction must be easier or harder")
+
+// CreateVariant creates an easier or harder problem based on an existing one and queues its
+// generation. The variant shares the base problem's focus areas and is linked to it through
+// easier_than or harder_than; GenerateProblemText then writes the text relative to the base.
+func (s *ProblemService) CreateVariant(ctx context.Context, baseID uuid.UUID, direction, modelRef, userID string) (uuid.UUID, uuid.UUID, error) {
+	if direction != VariantEasier && direction != VariantHarder {
+		return uuid.Nil, uuid.Nil, ErrInvalidDirection
+	}
+
+	base, err := s.problemRepo.GetByID(ctx, baseID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to get problem: %w", err)
+	}
+	if base.ProblemText == "" {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("%w: problem has no problem text yet", ErrMissingArtifacts)
+	}
+
+	var modelID *uuid.UUID
+	if modelRef != "" {
+		model, err := s.LookupModel(ctx, modelRef)
+		if err != nil {
+			return uuid.Nil, uuid.Nil, err
+		}
+		modelID = &model.ID
+	} else {
+		latest, err := s.jobRepo.GetLatestForProblem(ctx, baseID)
+		if err != nil {
+			return uuid.Nil, uuid.Nil, err
+		}
+		if latest != nil {
+			modelID = latest.ModelID
+		}
+	}
+
+	// A harder variant records the base as the easier problem, and vice versa
+	variant := repository.NewProblem{GeneratedByUserID: userID, GeneratedByModelID: modelID}
+	if direction == VariantHarder {
+		variant.EasierThan = &baseID
+	} else {
+		variant.HarderThan = &baseID
+	}
+
+	focusAreas, err := s.focusRepo.GetForProblem(ctx, baseID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	for _, fa := range focusAreas {
+		variant.FocusAreaIDs = append(variant.FocusAreaIDs, fa.ID)
+	}
+
+	problemID, jobID, err := s.problemRepo.CreateWithJob(ctx, variant)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("failed to create variant: %w", err)
+	}
+	return problemID, jobID, nil
+}
+
+// variantBase returns the problem a variant was derived from and the direction it was
+// adjusted in, or nil if the problem is not a variant
+func (s *ProblemService) variantBase(ctx context.Context, problem *models.ProblemWithTestCases) (*models.ProblemWithTestCases, string, error) {
+	var baseID *uuid.UUID
+	direction := ""
+	switch {
+	case problem.HarderThan != nil:
+		baseID, direction = problem.HarderThan, VariantEasier
+	case problem.EasierThan != nil:
+		baseID, direction = problem.EasierThan, VariantHarder
+	default:
+		return nil, "", nil
+	}
+
+	base, err := s.problemRepo.GetByID(ctx, *baseID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get base problem: %w", err)
+	}
+	return base, direction, nil
+}
+
+// DifficultyChain returns every problem linked to the given one by difficulty, ordered from
+// easiest to hardest. Level is relative to the given problem: negative levels are easier.
+func (s *ProblemService) DifficultyChain(ctx context.Context, problemID uuid.UUID) ([]models.DifficultyLink, error) {
+	links, err := s.problemRepo.GetDifficultyLinks(ctx, problemID)
+	if err != nil {
+		return nil, err
+	}
+
+	type edge struct {
+		to    uuid.UUID
+		delta int
+	}
+	edges := make(map[uuid.UUID][]edge)
+	for _, l := range links {
+		if l.EasierThan != nil {
+			edges[l.ProblemID] = append(edges[l.ProblemID], edge{*l.EasierThan, -1})
+			edges[*l.EasierThan] = append(edges[*l.EasierThan], edge{l.ProblemID, 1})
+		}
+		if l.HarderThan != nil {
+			edges[l.ProblemID] = append(edges[l.ProblemID], edge{*l.HarderThan, 1})
+			edges[*l.HarderThan] = append(edges[*l.HarderThan], edge{l.ProblemID, -1})
+		}
+	}
+
+	levels := map[uuid.UUID]int{problemID: 0}
+	queue := []uuid.UUID{problemID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range edges[id] {
+			if _, seen := levels[e.to]; !seen {
+				levels[e.to] = levels[id] + e.delta
+				queue = append(queue, e.to)
+			}
+		}
+	}
+
+	for i := range links {
+		links[i].Level = levels[links[i].ProblemID]
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Level < links[j].Level
+	})
+	return links, nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/boobachad/clankerloop/re-clanker/backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Worker runs pending generation jobs inside the API process
+type Worker struct {
+	jobRepo        *repository.GenerationJobRepository
+	problemService *ProblemService
+	concurrency    int
+	pollInterval   time.Duration
+	// lease is how long a job may go without a heartbeat before another worker reclaims it
+	lease time.Duration
+	wg    sync.WaitGroup
+}
+
+// NewWorker creates a new generation worker pool
+func NewWorker(
+	jobRepo *repository.GenerationJobRepository,
+	problemService *ProblemService,
+	concurrency int,
+	pollInterval time.Duration,
+	lease time.Duration,
+) *Worker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Worker{
+		jobRepo:        jobRepo,
+		problemService: problemService,
+		concurrency:    concurrency,
+		pollInterval:   pollInterval,
+		lease:          lease,
+	}
+}
+
+// Start launches the worker goroutines. They exit once ctx is cancelled.
+func (w *Worker) Start(ctx context.Context) {
+	for i := 0; i < w.concurrency; i++ {
+		w.wg.Add(1)
+		go func(id int) {
+			defer w.wg.Done()
+			w.run(ctx, id)
+		}(i)
+	}
+}
+
+// Wait blocks until all worker goroutines have exited
+func (w *Worker) Wait() {
+	w.wg.Wait()
+}
+
+// run claims and processes jobs until ctx is cancelled
+func (w *Worker) run(ctx context.Context, id int) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		job, err := w.jobRepo.ClaimPending(ctx, w.lease)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Worker %d: %v", id, err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.pollInterval):
+			}
+			continue
+		}
+
+		log.Printf("Worker %d: processing generation job %s for problem %s", id, job.ID, job.ProblemID)
+		start := time.Now()
+		stopHeartbeat := w.heartbeat(ctx, job.ID)
+		err = w.problemService.ProcessJob(ctx, job)
+		stopHeartbeat()
+		if err != nil {
+			log.Printf("Worker %d: generation job %s failed after %v: %v", id, job.ID, time.Since(start), err)
+			continue
+		}
+		log.Printf("Worker %d: generation job %s completed in %v", id, job.ID, time.Since(start))
+	}
+}
+
+// heartbeat renews a job's lease until the returned function is called
+func (w *Worker) heartbeat(ctx context.Context, jobID uuid.UUID) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(w.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.jobRepo.Heartbeat(ctx, jobID); err != nil && ctx.Err() == nil {
+					log.Printf("Generation job %s: %v", jobID, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,93 @@
+package signature
+
+import "sort"
+
+// JSONSchema returns a JSON Schema describing the FunctionSignatureSchema wire format,
+// for use as a structured output schema. The recursive TypeDef grammar is expressed
+// through $defs; the finer rules (identifiers, references, map keys) are left to Validate.
+func JSONSchema() map[string]interface{} {
+	typeRef := map[string]interface{}{"$ref": "#/$defs/TypeDef"}
+	kind := func(k Kind) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "enum": []interface{}{string(k)}}
+	}
+	variant := func(k Kind, properties map[string]interface{}) map[string]interface{} {
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		required := []interface{}{"kind"}
+		for _, name := range names {
+			required = append(required, name)
+		}
+		properties["kind"] = kind(k)
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	}
+
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"version":      map[string]interface{}{"type": "integer", "enum": []interface{}{float64(CurrentVersion)}},
+			"functionName": map[string]interface{}{"type": "string"},
+			"parameters": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":        map[string]interface{}{"type": "string"},
+						"type":        typeRef,
+						"optional":    map[string]interface{}{"type": "boolean"},
+						"description": map[string]interface{}{"type": "string"},
+					},
+					"required":             []interface{}{"name", "type"},
+					"additionalProperties": false,
+				},
+			},
+			"returnType": typeRef,
+			"namedTypes": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":        map[string]interface{}{"type": "string"},
+						"definition":  typeRef,
+						"description": map[string]interface{}{"type": "string"},
+					},
+					"required":             []interface{}{"name", "definition"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []interface{}{"version", "functionName", "parameters", "returnType"},
+		"additionalProperties": false,
+		"$defs": map[string]interface{}{
+			"TypeDef": map[string]interface{}{
+				"anyOf": []interface{}{
+					variant(KindPrimitive, map[string]interface{}{
+						"type": map[string]interface{}{
+							"type": "string",
+							"enum": []interface{}{PrimitiveInt, PrimitiveFloat, PrimitiveString, PrimitiveBoolean, PrimitiveNull},
+						},
+					}),
+					variant(KindArray, map[string]interface{}{"items": typeRef}),
+					variant(KindObject, map[string]interface{}{
+						"properties": map[string]interface{}{"type": "object", "additionalProperties": typeRef},
+					}),
+					variant(KindMap, map[string]interface{}{"keyType": typeRef, "valueType": typeRef}),
+					variant(KindTuple, map[string]interface{}{
+						"items": map[string]interface{}{"type": "array", "items": typeRef},
+					}),
+					variant(KindUnion, map[string]interface{}{
+						"types": map[string]interface{}{"type": "array", "items": typeRef},
+					}),
+					variant(KindReference, map[string]interface{}{"name": map[string]interface{}{"type": "string"}}),
+				},
+			},
+		},
+	}
+}
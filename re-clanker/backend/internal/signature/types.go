@@ -0,0 +1,199 @@
+package signature
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Kind identifies the shape of a TypeDef
+type Kind string
+
+// Type kinds, matching the TypeDef union in packages/api-types
+const (
+	KindPrimitive Kind = "primitive"
+	KindArray     Kind = "array"
+	KindObject    Kind = "object"
+	KindMap       Kind = "map"
+	KindTuple     Kind = "tuple"
+	KindUnion     Kind = "union"
+	KindReference Kind = "reference"
+)
+
+// Primitive type names
+const (
+	PrimitiveInt     = "int"
+	PrimitiveFloat   = "float"
+	PrimitiveString  = "string"
+	PrimitiveBoolean = "boolean"
+	PrimitiveNull    = "null"
+)
+
+// CurrentVersion is the only schema version understood by this package
+const CurrentVersion = 1
+
+// FunctionSignatureSchema is the typed form of problems.function_signature_schema
+type FunctionSignatureSchema struct {
+	Version      int         `json:"version"`
+	FunctionName string      `json:"functionName"`
+	Parameters   []Parameter `json:"parameters"`
+	ReturnType   *TypeDef    `json:"returnType"`
+	NamedTypes   []NamedType `json:"namedTypes,omitempty"`
+}
+
+// Parameter is a single function parameter
+type Parameter struct {
+	Name        string   `json:"name"`
+	Type        *TypeDef `json:"type"`
+	Optional    bool     `json:"optional,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// NamedType is a reusable type such as a custom struct, referenced by name
+// (e.g. a recursive TreeNode)
+type NamedType struct {
+	Name        string   `json:"name"`
+	Definition  *TypeDef `json:"definition"`
+	Description string   `json:"description,omitempty"`
+}
+
+// TypeDef describes a parameter or return type. Which fields are set depends on Kind.
+type TypeDef struct {
+	Kind Kind
+
+	// Primitive is the primitive type name (KindPrimitive)
+	Primitive string
+	// Items is the element type (KindArray)
+	Items *TypeDef
+	// Elements are the positional element types (KindTuple)
+	Elements []*TypeDef
+	// Properties are the fields of an inline object (KindObject)
+	Properties map[string]*TypeDef
+	// KeyType and ValueType describe a map (KindMap)
+	KeyType   *TypeDef
+	ValueType *TypeDef
+	// Types are the alternatives of a union (KindUnion)
+	Types []*TypeDef
+	// Name is the referenced named type (KindReference)
+	Name string
+}
+
+// typeDefJSON is the wire format of a TypeDef. "items" is a single type for arrays
+// and a list of types for tuples, so it is decoded once the kind is known.
+type typeDefJSON struct {
+	Kind       Kind                `json:"kind"`
+	Type       string              `json:"type,omitempty"`
+	Items      json.RawMessage     `json:"items,omitempty"`
+	Properties map[string]*TypeDef `json:"properties,omitempty"`
+	KeyType    *TypeDef            `json:"keyType,omitempty"`
+	ValueType  *TypeDef            `json:"valueType,omitempty"`
+	Types      []*TypeDef          `json:"types,omitempty"`
+	Name       string              `json:"name,omitempty"`
+}
+
+// MarshalJSON encodes the type in the api-types wire format
+func (t *TypeDef) MarshalJSON() ([]byte, error) {
+	out := typeDefJSON{Kind: t.Kind}
+	switch t.Kind {
+	case KindPrimitive:
+		out.Type = t.Primitive
+	case KindArray:
+		items, err := json.Marshal(t.Items)
+		if err != nil {
+			return nil, err
+		}
+		out.Items = items
+	case KindTuple:
+		items, err := json.Marshal(t.Elements)
+		if err != nil {
+			return nil, err
+		}
+		out.Items = items
+	case KindObject:
+		out.Properties = t.Properties
+	case KindMap:
+		out.KeyType = t.KeyType
+		out.ValueType = t.ValueType
+	case KindUnion:
+		out.Types = t.Types
+	case KindReference:
+		out.Name = t.Name
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes the api-types wire format
+func (t *TypeDef) UnmarshalJSON(data []byte) error {
+	var in typeDefJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	*t = TypeDef{
+		Kind:       in.Kind,
+		Primitive:  in.Type,
+		Properties: in.Properties,
+		KeyType:    in.KeyType,
+		ValueType:  in.ValueType,
+		Types:      in.Types,
+		Name:       in.Name,
+	}
+
+	if len(in.Items) == 0 {
+		return nil
+	}
+	switch in.Kind {
+	case KindArray:
+		if err := json.Unmarshal(in.Items, &t.Items); err != nil {
+			return fmt.Errorf("array items must be a single type: %w", err)
+		}
+	case KindTuple:
+		if err := json.Unmarshal(in.Items, &t.Elements); err != nil {
+			return fmt.Errorf("tuple items must be a list of types: %w", err)
+		}
+	}
+	return nil
+}
+
+// Parse decodes a schema from its JSON form
+func Parse(data []byte) (*FunctionSignatureSchema, error) {
+	var schema FunctionSignatureSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to decode function signature schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// FromMap decodes a schema stored as generic JSON, as found on models.Problem
+func FromMap(m map[string]interface{}) (*FunctionSignatureSchema, error) {
+	if m == nil {
+		return nil, fmt.Errorf("function signature schema is empty")
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode function signature schema: %w", err)
+	}
+	return Parse(data)
+}
+
+// ToMap encodes the schema as generic JSON for storage on models.Problem
+func (s *FunctionSignatureSchema) ToMap() (map[string]interface{}, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode function signature schema: %w", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to encode function signature schema: %w", err)
+	}
+	return m, nil
+}
+
+// NamedType returns the named type with the given name, or nil
+func (s *FunctionSignatureSchema) NamedType(name string) *NamedType {
+	for i := range s.NamedTypes {
+		if s.NamedTypes[i].Name == name {
+			return &s.NamedTypes[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package signature
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxTypeDepth bounds type nesting so a malformed schema cannot recurse forever
+const maxTypeDepth = 16
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidationError describes one violation of the type grammar
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Validate checks a schema against the fixed type grammar. All violations are
+// reported, joined into a single error, so they can be fed back to the model.
+func Validate(s *FunctionSignatureSchema) error {
+	v := &validator{schema: s}
+
+	if s.Version != CurrentVersion {
+		v.fail("version", "must be %d, got %d", CurrentVersion, s.Version)
+	}
+	if !identifierPattern.MatchString(s.FunctionName) {
+		v.fail("functionName", "%q is not a valid identifier", s.FunctionName)
+	}
+
+	names := make(map[string]bool, len(s.NamedTypes))
+	for i, nt := range s.NamedTypes {
+		path := fmt.Sprintf("namedTypes[%d]", i)
+		if !identifierPattern.MatchString(nt.Name) {
+			v.fail(path+".name", "%q is not a valid identifier", nt.Name)
+		}
+		if names[nt.Name] {
+			v.fail(path+".name", "duplicate named type %q", nt.Name)
+		}
+		names[nt.Name] = true
+	}
+	for i, nt := range s.NamedTypes {
+		v.checkType(fmt.Sprintf("namedTypes[%d].definition", i), nt.Definition, 0)
+	}
+	v.checkCycles()
+
+	seen := make(map[string]bool, len(s.Parameters))
+	for i, p := range s.Parameters {
+		path := fmt.Sprintf("parameters[%d]", i)
+		if !identifierPattern.MatchString(p.Name) {
+			v.fail(path+".name", "%q is not a valid identifier", p.Name)
+		}
+		if seen[p.Name] {
+			v.fail(path+".name", "duplicate parameter %q", p.Name)
+		}
+		seen[p.Name] = true
+		v.checkType(path+".type", p.Type, 0)
+	}
+
+	v.checkType("returnType", s.ReturnType, 0)
+
+	return errors.Join(v.errs...)
+}
+
+type validator struct {
+	schema *FunctionSignatureSchema
+	errs   []error
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) checkType(path string, t *TypeDef, depth int) {
+	if t == nil {
+		v.fail(path, "type is required")
+		return
+	}
+	if depth > maxTypeDepth {
+		v.fail(path, "types may be nested at most %d levels deep", maxTypeDepth)
+		return
+	}
+
+	switch t.Kind {
+	case KindPrimitive:
+		switch t.Primitive {
+		case PrimitiveInt, PrimitiveFloat, PrimitiveString, PrimitiveBoolean, PrimitiveNull:
+		default:
+			v.fail(path+".type", "unknown primitive type %q", t.Primitive)
+		}
+	case KindArray:
+		v.checkType(path+".items", t.Items, depth+1)
+	case KindObject:
+		if len(t.Properties) == 0 {
+			v.fail(path+".properties", "object must have at least one property")
+		}
+		for name, prop := range t.Properties {
+			if !identifierPattern.MatchString(name) {
+				v.fail(path+".properties", "%q is not a valid property name", name)
+			}
+			v.checkType(path+".properties."+name, prop, depth+1)
+		}
+	case KindMap:
+		if t.KeyType == nil {
+			v.fail(path+".keyType", "type is required")
+		} else if t.KeyType.Kind != KindPrimitive || (t.KeyType.Primitive != PrimitiveString && t.KeyType.Primitive != PrimitiveInt) {
+			v.fail(path+".keyType", "map keys must be primitive string or int")
+		}
+		v.checkType(path+".valueType", t.ValueType, depth+1)
+	case KindTuple:
+		if len(t.Elements) == 0 {
+			v.fail(path+".items", "tuple must have at least one element")
+		}
+		for i, el := range t.Elements {
+			v.checkType(fmt.Sprintf("%s.items[%d]", path, i), el, depth+1)
+		}
+	case KindUnion:
+		if len(t.Types) < 2 {
+			v.fail(path+".types", "union must have at least two alternatives")
+		}
+		for i, alt := range t.Types {
+			v.checkType(fmt.Sprintf("%s.types[%d]", path, i), alt, depth+1)
+		}
+	case KindReference:
+		if v.schema.NamedType(t.Name) == nil {
+			v.fail(path+".name", "reference to undefined named type %q", t.Name)
+		}
+	default:
+		v.fail(path+".kind", "unknown kind %q", t.Kind)
+	}
+}
+
+// checkCycles rejects named types that refer to themselves through nothing but references
+// and unions, such as A = A or A = B | int with B = A. Such a type describes no value, and
+// resolving it never reaches a value to check. Recursion through an array, object, map or
+// tuple is fine, since each level consumes part of the value.
+func (v *validator) checkCycles() {
+	// direct lists the named types each named type resolves to without consuming a value
+	direct := make(map[string][]string, len(v.schema.NamedTypes))
+	index := make(map[string]int, len(v.schema.NamedTypes))
+	for i, nt := range v.schema.NamedTypes {
+		direct[nt.Name] = unguardedReferences(nt.Definition, nil)
+		index[nt.Name] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(direct))
+	var stack []string
+	// visit returns the names on a cycle reachable from name, starting and ending with
+	// the same name
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, on := range stack {
+				if on == name {
+					return append(append([]string{}, stack[i:]...), name)
+				}
+			}
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, next := range direct[name] {
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+		return nil
+	}
+
+	for _, nt := range v.schema.NamedTypes {
+		if state[nt.Name] != unvisited {
+			continue
+		}
+		cycle := visit(nt.Name)
+		if cycle == nil {
+			continue
+		}
+		v.fail(fmt.Sprintf("namedTypes[%d].definition", index[cycle[0]]),
+			"%q refers to itself without an array, object, map or tuple in between (%s)",
+			cycle[0], strings.Join(cycle, " -> "))
+		// Each cycle is reported once
+		for _, name := range stack {
+			state[name] = done
+		}
+		stack = stack[:0]
+	}
+}
+
+// unguardedReferences appends the named types t refers to through references and unions only
+func unguardedReferences(t *TypeDef, names []string) []string {
+	if t == nil {
+		return names
+	}
+	switch t.Kind {
+	case KindReference:
+		return append(names, t.Name)
+	case KindUnion:
+		for _, alt := range t.Types {
+			names = unguardedReferences(alt, names)
+		}
+	}
+	return names
+}
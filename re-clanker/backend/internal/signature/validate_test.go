@@ -0,0 +1,280 @@
+package signature
+
+import (
+	"strings"
+	"testing"
+)
+
+// schemaWithNamedTypes builds a schema whose single parameter has the first named type
+func schemaWithNamedTypes(t *testing.T, namedTypes string) *FunctionSignatureSchema {
+	t.Helper()
+	schema, err := Parse([]byte(`{
+		"version": 1,
+		"functionName": "solve",
+		"parameters": [{"name": "x", "type": {"kind": "reference", "name": "A"}}],
+		"returnType": {"kind": "primitive", "type": "int"},
+		"namedTypes": ` + namedTypes + `
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestValidateReferenceCycles(t *testing.T) {
+	tests := []struct {
+		name       string
+		namedTypes string
+		// wantErr is a substring of the expected error, or empty if the schema is valid
+		wantErr string
+	}{
+		{
+			name: "recursion through object",
+			namedTypes: `[{"name": "A", "definition": {"kind": "object", "properties": {
+				"value": {"kind": "primitive", "type": "int"},
+				"next": {"kind": "union", "types": [{"kind": "reference", "name": "A"}, {"kind": "primitive", "type": "null"}]}
+			}}}]`,
+		},
+		{
+			name:       "recursion through array",
+			namedTypes: `[{"name": "A", "definition": {"kind": "array", "items": {"kind": "reference", "name": "A"}}}]`,
+		},
+		{
+			name: "recursion through map and tuple",
+			namedTypes: `[
+				{"name": "A", "definition": {"kind": "map", "keyType": {"kind": "primitive", "type": "string"}, "valueType": {"kind": "reference", "name": "B"}}},
+				{"name": "B", "definition": {"kind": "tuple", "items": [{"kind": "reference", "name": "A"}]}}
+			]`,
+		},
+		{
+			name: "reference chain without cycle",
+			namedTypes: `[
+				{"name": "A", "definition": {"kind": "reference", "name": "B"}},
+				{"name": "B", "definition": {"kind": "primitive", "type": "int"}}
+			]`,
+		},
+		{
+			name:       "self reference",
+			namedTypes: `[{"name": "A", "definition": {"kind": "reference", "name": "A"}}]`,
+			wantErr:    `namedTypes[0].definition: "A" refers to itself without an array, object, map or tuple in between (A -> A)`,
+		},
+		{
+			name: "mutual references",
+			namedTypes: `[
+				{"name": "A", "definition": {"kind": "reference", "name": "B"}},
+				{"name": "B", "definition": {"kind": "reference", "name": "A"}}
+			]`,
+			wantErr: "(A -> B -> A)",
+		},
+		{
+			name: "union of itself",
+			namedTypes: `[{"name": "A", "definition": {"kind": "union", "types": [
+				{"kind": "reference", "name": "A"}, {"kind": "primitive", "type": "int"}
+			]}}]`,
+			wantErr: "(A -> A)",
+		},
+		{
+			name: "unions referencing each other",
+			namedTypes: `[
+				{"name": "A", "definition": {"kind": "union", "types": [{"kind": "reference", "name": "B"}, {"kind": "primitive", "type": "int"}]}},
+				{"name": "B", "definition": {"kind": "union", "types": [{"kind": "reference", "name": "A"}, {"kind": "primitive", "type": "string"}]}}
+			]`,
+			wantErr: "(A -> B -> A)",
+		},
+		{
+			name: "cycle reached from another type is reported on the cycle",
+			namedTypes: `[
+				{"name": "A", "definition": {"kind": "reference", "name": "B"}},
+				{"name": "B", "definition": {"kind": "reference", "name": "C"}},
+				{"name": "C", "definition": {"kind": "reference", "name": "B"}}
+			]`,
+			wantErr: `namedTypes[1].definition: "B" refers to itself without an array, object, map or tuple in between (B -> C -> B)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(schemaWithNamedTypes(t, tt.namedTypes))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+			if n := strings.Count(err.Error(), "refers to itself"); n != 1 {
+				t.Errorf("cycle reported %d times, want once: %v", n, err)
+			}
+		})
+	}
+}
+
+// ValidateValue is also called on schemas that have not been through Validate, so a cycle
+// must fail instead of overflowing the stack
+func TestValidateValueUnvalidatedCycle(t *testing.T) {
+	tests := []struct {
+		name       string
+		namedTypes string
+		value      interface{}
+	}{
+		{
+			name:       "self reference",
+			namedTypes: `[{"name": "A", "definition": {"kind": "reference", "name": "A"}}]`,
+			value:      1.0,
+		},
+		{
+			name: "unions referencing each other",
+			namedTypes: `[
+				{"name": "A", "definition": {"kind": "union", "types": [{"kind": "reference", "name": "B"}, {"kind": "primitive", "type": "int"}]}},
+				{"name": "B", "definition": {"kind": "union", "types": [{"kind": "reference", "name": "A"}, {"kind": "primitive", "type": "int"}]}}
+			]`,
+			value: "not an int",
+		},
+		{
+			name: "cycle below an array",
+			namedTypes: `[
+				{"name": "A", "definition": {"kind": "array", "items": {"kind": "reference", "name": "B"}}},
+				{"name": "B", "definition": {"kind": "reference", "name": "B"}}
+			]`,
+			value: []interface{}{1.0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := schemaWithNamedTypes(t, tt.namedTypes)
+			if err := schema.ValidateArgs(map[string]interface{}{"x": tt.value}); err == nil {
+				t.Fatal("ValidateArgs() = nil, want error")
+			}
+		})
+	}
+}
+
+func TestValidateValueRecursiveType(t *testing.T) {
+	schema := schemaWithNamedTypes(t, `[{"name": "A", "definition": {"kind": "object", "properties": {
+		"value": {"kind": "primitive", "type": "int"},
+		"next": {"kind": "union", "types": [{"kind": "reference", "name": "A"}, {"kind": "primitive", "type": "null"}]}
+	}}}]`)
+	if err := Validate(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	list := map[string]interface{}{"value": 1.0, "next": map[string]interface{}{"value": 2.0, "next": nil}}
+	if err := schema.ValidateArgs(map[string]interface{}{"x": list}); err != nil {
+		t.Errorf("ValidateArgs() = %v, want nil", err)
+	}
+
+	bad := map[string]interface{}{"value": 1.0, "next": map[string]interface{}{"value": "two", "next": nil}}
+	if err := schema.ValidateArgs(map[string]interface{}{"x": bad}); err == nil {
+		t.Error("ValidateArgs() = nil, want error for a string value in the second node")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		// wantErrs are substrings of the expected error; none means the schema is valid
+		wantErrs []string
+	}{
+		{
+			name: "valid",
+			schema: `{"version": 1, "functionName": "twoSum",
+				"parameters": [
+					{"name": "nums", "type": {"kind": "array", "items": {"kind": "primitive", "type": "int"}}},
+					{"name": "target", "type": {"kind": "primitive", "type": "int"}, "optional": true}
+				],
+				"returnType": {"kind": "tuple", "items": [{"kind": "primitive", "type": "int"}, {"kind": "primitive", "type": "int"}]}}`,
+		},
+		{
+			name: "wrong version and bad function name",
+			schema: `{"version": 2, "functionName": "two sum", "parameters": [],
+				"returnType": {"kind": "primitive", "type": "int"}}`,
+			wantErrs: []string{"version: must be 1, got 2", `functionName: "two sum" is not a valid identifier`},
+		},
+		{
+			name: "duplicate parameter",
+			schema: `{"version": 1, "functionName": "f", "parameters": [
+					{"name": "a", "type": {"kind": "primitive", "type": "int"}},
+					{"name": "a", "type": {"kind": "primitive", "type": "int"}}
+				], "returnType": {"kind": "primitive", "type": "int"}}`,
+			wantErrs: []string{`parameters[1].name: duplicate parameter "a"`},
+		},
+		{
+			name:     "missing return type",
+			schema:   `{"version": 1, "functionName": "f", "parameters": []}`,
+			wantErrs: []string{"returnType: type is required"},
+		},
+		{
+			name: "unknown kind and primitive",
+			schema: `{"version": 1, "functionName": "f", "parameters": [
+					{"name": "a", "type": {"kind": "set", "items": {"kind": "primitive", "type": "int"}}}
+				], "returnType": {"kind": "primitive", "type": "char"}}`,
+			wantErrs: []string{`parameters[0].type.kind: unknown kind "set"`, `returnType.type: unknown primitive type "char"`},
+		},
+		{
+			name: "empty object, tuple and union",
+			schema: `{"version": 1, "functionName": "f", "parameters": [
+					{"name": "a", "type": {"kind": "object", "properties": {}}},
+					{"name": "b", "type": {"kind": "tuple", "items": []}},
+					{"name": "c", "type": {"kind": "union", "types": [{"kind": "primitive", "type": "int"}]}}
+				], "returnType": {"kind": "primitive", "type": "int"}}`,
+			wantErrs: []string{
+				"object must have at least one property",
+				"tuple must have at least one element",
+				"union must have at least two alternatives",
+			},
+		},
+		{
+			name: "map with float keys",
+			schema: `{"version": 1, "functionName": "f", "parameters": [
+					{"name": "a", "type": {"kind": "map", "keyType": {"kind": "primitive", "type": "float"}, "valueType": {"kind": "primitive", "type": "int"}}}
+				], "returnType": {"kind": "primitive", "type": "int"}}`,
+			wantErrs: []string{"parameters[0].type.keyType: map keys must be primitive string or int"},
+		},
+		{
+			name: "undefined reference and duplicate named type",
+			schema: `{"version": 1, "functionName": "f", "parameters": [
+					{"name": "a", "type": {"kind": "reference", "name": "Node"}}
+				], "returnType": {"kind": "primitive", "type": "int"},
+				"namedTypes": [
+					{"name": "Tree", "definition": {"kind": "primitive", "type": "int"}},
+					{"name": "Tree", "definition": {"kind": "primitive", "type": "int"}}
+				]}`,
+			wantErrs: []string{`reference to undefined named type "Node"`, `namedTypes[1].name: duplicate named type "Tree"`},
+		},
+		{
+			name: "nested too deep",
+			schema: `{"version": 1, "functionName": "f", "parameters": [], "returnType": ` +
+				strings.Repeat(`{"kind": "array", "items": `, maxTypeDepth+1) + `{"kind": "primitive", "type": "int"}` +
+				strings.Repeat("}", maxTypeDepth+1) + `}`,
+			wantErrs: []string{"types may be nested at most 16 levels deep"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := Parse([]byte(tt.schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = Validate(schema)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors %q", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, want error containing %q", err, want)
+				}
+			}
+		})
+	}
+}
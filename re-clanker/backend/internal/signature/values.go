@@ -0,0 +1,198 @@
+package signature
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// ValidateArgs checks a test input, keyed by parameter name, against the schema's parameters
+func (s *FunctionSignatureSchema) ValidateArgs(args map[string]interface{}) error {
+	known := make(map[string]bool, len(s.Parameters))
+	for _, p := range s.Parameters {
+		known[p.Name] = true
+		value, ok := args[p.Name]
+		if !ok {
+			if p.Optional {
+				continue
+			}
+			return fmt.Errorf("missing argument %q", p.Name)
+		}
+		if err := s.ValidateValue(p.Type, value); err != nil {
+			return fmt.Errorf("argument %q: %w", p.Name, err)
+		}
+	}
+
+	var unknown []string
+	for name := range args {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown arguments %v", unknown)
+	}
+	return nil
+}
+
+// ValidateValue checks a decoded JSON value against a type
+func (s *FunctionSignatureSchema) ValidateValue(t *TypeDef, value interface{}) error {
+	return s.validateValue(t, value, nil)
+}
+
+// validateValue checks value against t. resolving holds the named types resolved since the
+// last array, object, map or tuple, so a schema that has not been through Validate cannot
+// send it round a cycle of references forever.
+func (s *FunctionSignatureSchema) validateValue(t *TypeDef, value interface{}, resolving map[string]bool) error {
+	if t == nil {
+		return fmt.Errorf("missing type")
+	}
+
+	switch t.Kind {
+	case KindPrimitive:
+		return checkPrimitive(t.Primitive, value)
+	case KindArray:
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected array, got %s", describe(value))
+		}
+		for i, item := range items {
+			if err := s.validateValue(t.Items, item, nil); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+	case KindTuple:
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected tuple, got %s", describe(value))
+		}
+		if len(items) != len(t.Elements) {
+			return fmt.Errorf("expected tuple of %d elements, got %d", len(t.Elements), len(items))
+		}
+		for i, item := range items {
+			if err := s.validateValue(t.Elements[i], item, nil); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+	case KindObject:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected object, got %s", describe(value))
+		}
+		for name, prop := range t.Properties {
+			field, ok := obj[name]
+			if !ok {
+				return fmt.Errorf("missing property %q", name)
+			}
+			if err := s.validateValue(prop, field, nil); err != nil {
+				return fmt.Errorf(".%s: %w", name, err)
+			}
+		}
+		for name := range obj {
+			if _, ok := t.Properties[name]; !ok {
+				return fmt.Errorf("unknown property %q", name)
+			}
+		}
+	case KindMap:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected map, got %s", describe(value))
+		}
+		for key, v := range obj {
+			// JSON object keys are always strings, so integer keys arrive in decimal form
+			if t.KeyType != nil && t.KeyType.Primitive == PrimitiveInt {
+				if _, err := strconv.ParseInt(key, 10, 64); err != nil {
+					return fmt.Errorf("map key %q is not an integer", key)
+				}
+			}
+			if err := s.validateValue(t.ValueType, v, nil); err != nil {
+				return fmt.Errorf("[%q]: %w", key, err)
+			}
+		}
+	case KindUnion:
+		for _, alt := range t.Types {
+			if s.validateValue(alt, value, resolving) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s matches no alternative of the union", describe(value))
+	case KindReference:
+		nt := s.NamedType(t.Name)
+		if nt == nil {
+			return fmt.Errorf("reference to undefined named type %q", t.Name)
+		}
+		if resolving[t.Name] {
+			return fmt.Errorf("named type %q refers to itself without an array, object, map or tuple in between", t.Name)
+		}
+		next := make(map[string]bool, len(resolving)+1)
+		for name := range resolving {
+			next[name] = true
+		}
+		next[t.Name] = true
+		return s.validateValue(nt.Definition, value, next)
+	default:
+		return fmt.Errorf("unknown kind %q", t.Kind)
+	}
+	return nil
+}
+
+func checkPrimitive(primitive string, value interface{}) error {
+	switch primitive {
+	case PrimitiveNull:
+		if value != nil {
+			return fmt.Errorf("expected null, got %s", describe(value))
+		}
+	case PrimitiveBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected boolean, got %s", describe(value))
+		}
+	case PrimitiveString:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected string, got %s", describe(value))
+		}
+	case PrimitiveFloat:
+		if _, ok := toFloat(value); !ok {
+			return fmt.Errorf("expected number, got %s", describe(value))
+		}
+	case PrimitiveInt:
+		f, ok := toFloat(value)
+		if !ok || f != math.Trunc(f) {
+			return fmt.Errorf("expected integer, got %s", describe(value))
+		}
+	default:
+		return fmt.Errorf("unknown primitive type %q", primitive)
+	}
+	return nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64, json.Number:
+		return fmt.Sprintf("number %v", v)
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
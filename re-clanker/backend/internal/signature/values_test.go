@@ -0,0 +1,174 @@
+package signature
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func mustType(t *testing.T, data string) *TypeDef {
+	t.Helper()
+	var typ TypeDef
+	if err := json.Unmarshal([]byte(data), &typ); err != nil {
+		t.Fatal(err)
+	}
+	return &typ
+}
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   string
+		value string
+		// wantErr is a substring of the expected error, or empty if the value matches
+		wantErr string
+	}{
+		{"int", `{"kind": "primitive", "type": "int"}`, `3`, ""},
+		{"int with fraction", `{"kind": "primitive", "type": "int"}`, `3.5`, "expected integer, got number 3.5"},
+		{"int as string", `{"kind": "primitive", "type": "int"}`, `"3"`, "expected integer, got string"},
+		{"float accepts int", `{"kind": "primitive", "type": "float"}`, `3`, ""},
+		{"string", `{"kind": "primitive", "type": "string"}`, `"abc"`, ""},
+		{"boolean", `{"kind": "primitive", "type": "boolean"}`, `1`, "expected boolean, got number 1"},
+		{"null", `{"kind": "primitive", "type": "null"}`, `null`, ""},
+		{"null rejects value", `{"kind": "primitive", "type": "null"}`, `false`, "expected null, got boolean"},
+		{
+			"array",
+			`{"kind": "array", "items": {"kind": "primitive", "type": "int"}}`,
+			`[1, 2, 3]`, "",
+		},
+		{
+			"array with bad item",
+			`{"kind": "array", "items": {"kind": "primitive", "type": "int"}}`,
+			`[1, "2"]`, "[1]: expected integer, got string",
+		},
+		{
+			"tuple",
+			`{"kind": "tuple", "items": [{"kind": "primitive", "type": "int"}, {"kind": "primitive", "type": "string"}]}`,
+			`[1, "a"]`, "",
+		},
+		{
+			"tuple of wrong length",
+			`{"kind": "tuple", "items": [{"kind": "primitive", "type": "int"}, {"kind": "primitive", "type": "string"}]}`,
+			`[1]`, "expected tuple of 2 elements, got 1",
+		},
+		{
+			"object",
+			`{"kind": "object", "properties": {"x": {"kind": "primitive", "type": "int"}}}`,
+			`{"x": 1}`, "",
+		},
+		{
+			"object missing property",
+			`{"kind": "object", "properties": {"x": {"kind": "primitive", "type": "int"}}}`,
+			`{}`, `missing property "x"`,
+		},
+		{
+			"object with unknown property",
+			`{"kind": "object", "properties": {"x": {"kind": "primitive", "type": "int"}}}`,
+			`{"x": 1, "y": 2}`, `unknown property "y"`,
+		},
+		{
+			"map with int keys",
+			`{"kind": "map", "keyType": {"kind": "primitive", "type": "int"}, "valueType": {"kind": "primitive", "type": "string"}}`,
+			`{"1": "a", "-2": "b"}`, "",
+		},
+		{
+			"map with non-int key",
+			`{"kind": "map", "keyType": {"kind": "primitive", "type": "int"}, "valueType": {"kind": "primitive", "type": "string"}}`,
+			`{"one": "a"}`, `map key "one" is not an integer`,
+		},
+		{
+			"union",
+			`{"kind": "union", "types": [{"kind": "primitive", "type": "int"}, {"kind": "primitive", "type": "null"}]}`,
+			`null`, "",
+		},
+		{
+			"union without match",
+			`{"kind": "union", "types": [{"kind": "primitive", "type": "int"}, {"kind": "primitive", "type": "null"}]}`,
+			`"a"`, "string matches no alternative of the union",
+		},
+	}
+
+	schema := &FunctionSignatureSchema{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			err := schema.ValidateValue(mustType(t, tt.typ), value)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateValue() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateValue() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateArgs(t *testing.T) {
+	schema, err := Parse([]byte(`{"version": 1, "functionName": "f", "parameters": [
+			{"name": "a", "type": {"kind": "primitive", "type": "int"}},
+			{"name": "b", "type": {"kind": "primitive", "type": "string"}, "optional": true}
+		], "returnType": {"kind": "primitive", "type": "int"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		wantErr string
+	}{
+		{"all arguments", map[string]interface{}{"a": 1.0, "b": "x"}, ""},
+		{"optional argument left out", map[string]interface{}{"a": 1.0}, ""},
+		{"required argument left out", map[string]interface{}{"b": "x"}, `missing argument "a"`},
+		{"wrong type", map[string]interface{}{"a": "1"}, `argument "a": expected integer`},
+		{"unknown arguments", map[string]interface{}{"a": 1.0, "d": 1.0, "c": 1.0}, "unknown arguments [c d]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.ValidateArgs(tt.args)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateArgs() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateArgs() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TypeDef's "items" holds a single type for arrays and a list for tuples
+func TestTypeDefJSONRoundTrip(t *testing.T) {
+	tests := []string{
+		`{"kind":"primitive","type":"int"}`,
+		`{"kind":"array","items":{"kind":"primitive","type":"string"}}`,
+		`{"kind":"tuple","items":[{"kind":"primitive","type":"int"},{"kind":"primitive","type":"float"}]}`,
+		`{"kind":"object","properties":{"left":{"kind":"reference","name":"Node"}}}`,
+		`{"kind":"map","keyType":{"kind":"primitive","type":"int"},"valueType":{"kind":"primitive","type":"boolean"}}`,
+		`{"kind":"union","types":[{"kind":"primitive","type":"int"},{"kind":"primitive","type":"null"}]}`,
+		`{"kind":"reference","name":"Node"}`,
+	}
+	for _, data := range tests {
+		typ := mustType(t, data)
+		out, err := json.Marshal(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != data {
+			t.Errorf("round trip of %s = %s", data, out)
+		}
+	}
+
+	var typ TypeDef
+	if err := json.Unmarshal([]byte(`{"kind":"array","items":[{"kind":"primitive","type":"int"}]}`), &typ); err == nil {
+		t.Error("decoding an array with a list of items succeeded, want error")
+	}
+}